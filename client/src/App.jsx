@@ -1,10 +1,16 @@
-import { useState } from 'react'
+import { useEffect, useState } from 'react'
 import TaskList from './components/TaskList'
+import Login from './components/Login'
+import { apiFetch, clearTokens, errorMessage, getTokens, onLogout } from './api'
 
 function App() {
+  const [loggedIn, setLoggedIn] = useState(getTokens() !== null)
   const [tasks, setTasks] = useState([])
   const [taskContent, setTaskContent] = useState('');
 
+  // Back to the login form when the session expires
+  useEffect(() => onLogout(() => setLoggedIn(false)), [])
+
   const AddTask = async (event) => {
     event.preventDefault()
     if (taskContent.trim() === '') {
@@ -12,7 +18,7 @@ function App() {
       return;
     }
     try {
-      const response = await fetch('http://localhost/tasks', {
+      const response = await apiFetch('/tasks', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -25,25 +31,41 @@ function App() {
         setTaskContent('');
         console.log('Task created !');
       } else {
-          const errorData = await response.json();
-          const errorMessage = errorData.error || 'Unknown error occured';
-          throw new Error(`HTTP error : ${errorMessage}`);
+          throw new Error(`HTTP error : ${await errorMessage(response)}`);
       };
     } catch (error) {
       console.error(error);
     }
   }
 
+  const Logout = async () => {
+    try {
+      await apiFetch('/auth/logout', { method: 'POST' });
+    } catch (error) {
+      console.error(error);
+    }
+    clearTokens();
+    setTasks([]);
+    setLoggedIn(false);
+  }
+
   return (
     <div className='h-screen bg-slate-800'>
       <div className="max-w-4xl mx-auto pt-20 px-6">
-        <h1 className='text-3xl text-slate-400 mb-4'>Todo-List</h1>
-        <form onSubmit={e => AddTask(e)} className='mb-10'>
-          <label htmlFor='todo-item' className='text-slate-50'>Tasks</label>
-          <input value={taskContent} onChange={e => setTaskContent(e.target.value)} type='text' className='mt-1 block w-full rounded'/>
-          <button className='mt-4 py-2 px-2 bg-slate-50 rounded min-w-[115px]'>Add a task</button>
-        </form>
-        <TaskList setTasks={setTasks} tasks={tasks}/>
+        <div className='flex justify-between items-baseline'>
+          <h1 className='text-3xl text-slate-400 mb-4'>Todo-List</h1>
+          {loggedIn && <button className='text-slate-400 underline' onClick={Logout}>Log out</button>}
+        </div>
+        {!loggedIn ? <Login onLogin={() => setLoggedIn(true)}/> : (
+          <>
+            <form onSubmit={e => AddTask(e)} className='mb-10'>
+              <label htmlFor='todo-item' className='text-slate-50'>Tasks</label>
+              <input value={taskContent} onChange={e => setTaskContent(e.target.value)} type='text' className='mt-1 block w-full rounded'/>
+              <button className='mt-4 py-2 px-2 bg-slate-50 rounded min-w-[115px]'>Add a task</button>
+            </form>
+            <TaskList setTasks={setTasks} tasks={tasks}/>
+          </>
+        )}
       </div>
     </div>
   )
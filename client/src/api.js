@@ -0,0 +1,91 @@
+// Base URL of the version of the server API used by the client
+export const API_URL = 'http://localhost/api/v1';
+
+// Key of the tokens of the session in local storage
+const TOKENS_KEY = 'todolist.tokens';
+
+// Random lowercase hex string of the given number of bytes
+function randomHex(bytes) {
+    const values = crypto.getRandomValues(new Uint8Array(bytes));
+    return Array.from(values, b => b.toString(16).padStart(2, '0')).join('');
+}
+
+// Headers starting a new W3C trace for a request, continued by the server.
+// The trace is not flagged as sampled, so that the server decides.
+export function traceHeaders() {
+    return { traceparent: `00-${randomHex(16)}-${randomHex(8)}-00` };
+}
+
+// Tokens of the current session, null when logged out
+export function getTokens() {
+    try {
+        return JSON.parse(localStorage.getItem(TOKENS_KEY));
+    } catch {
+        return null;
+    }
+}
+
+export function setTokens(tokens) {
+    localStorage.setItem(TOKENS_KEY, JSON.stringify(tokens));
+}
+
+export function clearTokens() {
+    localStorage.removeItem(TOKENS_KEY);
+}
+
+// Called when the session cannot be refreshed anymore
+let logoutHandler = () => {};
+export function onLogout(handler) {
+    logoutHandler = handler;
+}
+
+// refreshTokens exchanges the refresh token for a new pair of tokens
+async function refreshTokens() {
+    const tokens = getTokens();
+    if (!tokens) {
+        return false;
+    }
+    const response = await fetch(`${API_URL}/auth/refresh`, {
+        method: 'POST',
+        headers: { ...traceHeaders(), 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: tokens.refresh_token }),
+    });
+    if (!response.ok) {
+        return false;
+    }
+    setTokens(await response.json());
+    return true;
+}
+
+// apiFetch sends a request to the API with the access token of the session,
+// refreshing it once when it expired
+export async function apiFetch(path, options = {}) {
+    const send = () => {
+        const tokens = getTokens();
+        const auth = tokens ? { Authorization: `Bearer ${tokens.access_token}` } : {};
+        return fetch(`${API_URL}${path}`, {
+            ...options,
+            headers: { ...traceHeaders(), ...options.headers, ...auth },
+        });
+    };
+    let response = await send();
+    if (response.status === 401 && getTokens()) {
+        if (await refreshTokens()) {
+            response = await send();
+        } else {
+            clearTokens();
+            logoutHandler();
+        }
+    }
+    return response;
+}
+
+// errorMessage returns the message of a problem+json error response
+export async function errorMessage(response) {
+    try {
+        const errorData = await response.json();
+        return (errorData.errors && errorData.errors.map(e => e.message).join(', ')) || errorData.detail || errorData.title || 'Unknown error occurred';
+    } catch {
+        return `HTTP error status: ${response.status}`;
+    }
+}
@@ -0,0 +1,56 @@
+import { useState } from 'react'
+import { API_URL, errorMessage, setTokens, traceHeaders } from '../api';
+
+// Login and register form, onLogin is called once the tokens are stored
+export default function Login({ onLogin }) {
+    const [register, setRegister] = useState(false);
+    const [username, setUsername] = useState('');
+    const [password, setPassword] = useState('');
+    const [error, setError] = useState('');
+
+    async function post(path) {
+        return fetch(`${API_URL}${path}`, {
+            method: 'POST',
+            headers: { ...traceHeaders(), 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password }),
+        });
+    }
+
+    async function submit(event) {
+        event.preventDefault();
+        setError('');
+        try {
+            if (register) {
+                const response = await post('/auth/register');
+                if (!response.ok) {
+                    setError(await errorMessage(response));
+                    return;
+                }
+            }
+            const response = await post('/auth/login');
+            if (!response.ok) {
+                setError(await errorMessage(response));
+                return;
+            }
+            setTokens(await response.json());
+            onLogin();
+        } catch (error) {
+            setError(error.message);
+        }
+    }
+
+    return (
+        <form onSubmit={submit} className='mb-10'>
+            <label htmlFor='username' className='text-slate-50'>Username</label>
+            <input id='username' value={username} onChange={e => setUsername(e.target.value)} type='text' autoComplete='username' className='mt-1 mb-4 block w-full rounded'/>
+            <label htmlFor='password' className='text-slate-50'>Password</label>
+            <input id='password' value={password} onChange={e => setPassword(e.target.value)} type='password'
+                autoComplete={register ? 'new-password' : 'current-password'} className='mt-1 block w-full rounded'/>
+            {error && <p className='mt-2 text-red-400'>{error}</p>}
+            <button className='mt-4 py-2 px-2 bg-slate-50 rounded min-w-[115px]'>{register ? 'Register' : 'Log in'}</button>
+            <button type='button' className='mt-4 ml-4 text-slate-400 underline' onClick={() => { setRegister(!register); setError(''); }}>
+                {register ? 'I already have an account' : 'Create an account'}
+            </button>
+        </form>
+    )
+}
@@ -3,32 +3,38 @@ import DeleteForeverRoundedIcon from '@mui/icons-material/DeleteForeverRounded';
 import ModeEditOutlineRoundedIcon from '@mui/icons-material/ModeEditOutlineRounded';
 import CheckCircleIcon from '@mui/icons-material/CheckCircle';
 import CancelIcon from '@mui/icons-material/Cancel';
+import { apiFetch, errorMessage } from '../api';
 
 export default function TaskList({tasks, setTasks}) {
     const [editableTaskId, setEditableTaskId] = useState(null);
     const [editedContent, setEditedContent] = useState('');
 
+    // loadTasks replaces the tasks by the ones of the server, kept as is on errors
+    async function loadTasks() {
+        try {
+            const response = await apiFetch('/tasks');
+            if (!response.ok) {
+                throw new Error(await errorMessage(response));
+            }
+            setTasks(await response.json());
+        } catch (error) {
+            console.error('Error while getting tasks', error);
+        }
+    }
+
     useEffect(() => {
-        fetch('http://localhost/tasks', {
-            method: 'GET'
-        })
-            .then(response => response.json())
-            .then(data => setTasks(data))
-            .catch(error => console.error('Error while getting tasks', error));
+        loadTasks();
     }, [])
     // Sort tasks by id
     const sortedTasks = [...tasks].sort((a, b) => a.id - b.id);
 
     function deleteTask(id){
-        fetch(`http://localhost/tasks/${id}`, {
+        apiFetch(`/tasks/${id}`, {
             method: 'DELETE'
         })
-        .then(response => {
+        .then(async response => {
             if (!response.ok) {
-                return response.json().then(errorData => {
-                    const errorMessage = errorData.detail || errorData.error || 'Unknown error occurred';
-                    throw new Error(`HTTP error status: ${response.status}, Message: ${errorMessage}`);
-                });
+                throw new Error(`HTTP error status: ${response.status}, Message: ${await errorMessage(response)}`);
             }
             return response.json();
         })
@@ -42,25 +48,22 @@ export default function TaskList({tasks, setTasks}) {
     }
 
     async function saveEditTask(id) {
+        // Only save over the version of the task being edited, and only
+        // change its content : PUT would reset every other field
+        const task = tasks.find(task => task.id === id);
         try {
-            const response = await fetch(`http://localhost/tasks/${id}`, {
-            method: 'PUT',
+            const response = await apiFetch(`/tasks/${id}`, {
+            method: 'PATCH',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'If-Match': `"${task.version}"`
             },
             body: JSON.stringify({ content: editedContent })
             });
             if (response.ok) {
-                fetch('http://localhost/tasks', {
-                    method: 'GET'
-                })
-                    .then(response => response.json())
-                    .then(data => setTasks(data))
-                    .catch(error => console.error('Error while getting tasks', error));
+                loadTasks();
             } else {
-                const errorData = await response.json();
-                const errorMessage = errorData.error || 'Unknown error occured';
-                throw new Error(`HTTP error : ${errorMessage}`);
+                throw new Error(`HTTP error : ${await errorMessage(response)}`);
             }
         } catch (error) {
             console.error(error);
@@ -81,18 +84,18 @@ export default function TaskList({tasks, setTasks}) {
 
     async function changeTaskState(task) {
         try {
-            const response = await fetch(`http://localhost/tasks/state/${task.id}`, {
+            const response = await apiFetch(`/tasks/${task.id}/state`, {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json'
-            },})
+            },
+            body: JSON.stringify({ state: !task.state })
+            })
             if (response.ok) {
-                fetch('http://localhost/tasks', {
-                    method: 'GET'
-                })
-                    .then(response => response.json())
-                    .then(data => setTasks(data))
-                    .catch(error => console.error('Error while getting tasks', error))};
+                loadTasks();
+            } else {
+                throw new Error(`HTTP error : ${await errorMessage(response)}`);
+            }
         } catch (error) {
             console.error(error);
         }
@@ -0,0 +1,34 @@
+package auth
+
+import "strings"
+
+// Scopes of a principal
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// Every API key starts with this prefix, so that they can be told apart from session tokens
+const APIKeyPrefix = "tdk_"
+
+// Number of characters of a key shown when listing keys
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeReadWrite
+}
+
+// NewAPIKey returns a random API key, the beginning of the key that can be
+// shown to identify it, and the hash to store in database
+func NewAPIKey() (key, prefix, hash string, err error) {
+	token, _, err := NewToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, key[:apiKeyDisplayLength], HashToken(key), nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
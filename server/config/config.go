@@ -0,0 +1,375 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of every environment variable read by Load
+const envPrefix = "TODOLIST_"
+
+// Config holds everything the server needs to start.
+// Values are resolved with the following precedence (highest first) :
+// command line flags, environment variables, config file, defaults.
+type Config struct {
+	ListenAddr      string        `json:"listen_addr"`
+	AdminListenAddr string        `json:"admin_listen_addr"`
+	CORSOrigins     []string      `json:"cors_origins"`
+	ReadTimeout     Duration      `json:"read_timeout"`
+	WriteTimeout    Duration      `json:"write_timeout"`
+	IdleTimeout     Duration      `json:"idle_timeout"`
+	ShutdownTimeout Duration      `json:"shutdown_timeout"`
+	AccessTokenTTL  Duration      `json:"access_token_ttl"`
+	RefreshTokenTTL Duration      `json:"refresh_token_ttl"`
+	DB              DBConfig      `json:"db"`
+	Log             LogConfig     `json:"log"`
+	Tracing         TracingConfig `json:"tracing"`
+
+	// Positional arguments left after the flags
+	Args []string `json:"-"`
+}
+
+// Database connexion settings
+type DBConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	// Apply pending schema migrations at startup
+	AutoMigrate bool `json:"auto_migrate"`
+	// Maximum duration of each query, none if 0
+	QueryTimeout Duration `json:"query_timeout"`
+	// Connexion pool, 0 means no limit for MaxOpenConns and ConnMaxLifetime
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+}
+
+// Logging settings
+type LogConfig struct {
+	// Minimum level of the records : debug, info, warn or error
+	Level string `json:"level"`
+	// Output format : json or text
+	Format string `json:"format"`
+}
+
+// Tracing settings
+type TracingConfig struct {
+	// Where spans are sent : none, otlp or stdout
+	Exporter string `json:"exporter"`
+	// URL of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables
+	// are used if empty
+	Endpoint string `json:"endpoint"`
+	// Fraction of new traces which are sampled, between 0 and 1
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// Default returns the configuration used when nothing else is provided.
+// It matches the docker-compose development stack.
+func Default() *Config {
+	return &Config{
+		ListenAddr:      ":9000",
+		AdminListenAddr: ":9100",
+		CORSOrigins:     []string{"http://localhost:3000"},
+		ReadTimeout:     Duration(10 * time.Second),
+		WriteTimeout:    Duration(30 * time.Second),
+		IdleTimeout:     Duration(2 * time.Minute),
+		ShutdownTimeout: Duration(15 * time.Second),
+		AccessTokenTTL:  Duration(15 * time.Minute),
+		RefreshTokenTTL: Duration(30 * 24 * time.Hour),
+		DB: DBConfig{
+			Host:            "database",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "todolist_db",
+			AutoMigrate:     true,
+			QueryTimeout:    Duration(5 * time.Second),
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the optional config file
+// (given by -config or TODOLIST_CONFIG), the environment and the command
+// line arguments, then validates it.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+
+	// First pass on flags only to find the config file path
+	var path string
+	fs := newFlagSet(Default(), &path)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(cfg, getenv); err != nil {
+		return nil, err
+	}
+
+	// Second pass : flags explicitly set override everything else
+	fs = newFlagSet(cfg, &path)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg.Args = fs.Args()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("todolist", flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "path to a JSON config file")
+	fs.StringVar(&cfg.ListenAddr, "listen", cfg.ListenAddr, "HTTP listen address")
+	fs.StringVar(&cfg.AdminListenAddr, "admin-listen", cfg.AdminListenAddr, "listen address of the admin server serving /metrics, empty to disable it")
+	fs.Var((*listValue)(&cfg.CORSOrigins), "cors-origins", "comma separated list of allowed CORS origins")
+	fs.DurationVar((*time.Duration)(&cfg.ReadTimeout), "read-timeout", time.Duration(cfg.ReadTimeout), "maximum duration for reading a request")
+	fs.DurationVar((*time.Duration)(&cfg.WriteTimeout), "write-timeout", time.Duration(cfg.WriteTimeout), "maximum duration for writing a response")
+	fs.DurationVar((*time.Duration)(&cfg.IdleTimeout), "idle-timeout", time.Duration(cfg.IdleTimeout), "maximum time to keep an idle connection open")
+	fs.DurationVar((*time.Duration)(&cfg.ShutdownTimeout), "shutdown-timeout", time.Duration(cfg.ShutdownTimeout), "maximum time to drain in-flight requests on shutdown")
+	fs.DurationVar((*time.Duration)(&cfg.AccessTokenTTL), "access-token-ttl", time.Duration(cfg.AccessTokenTTL), "lifetime of access tokens")
+	fs.DurationVar((*time.Duration)(&cfg.RefreshTokenTTL), "refresh-token-ttl", time.Duration(cfg.RefreshTokenTTL), "lifetime of refresh tokens")
+	fs.StringVar(&cfg.DB.Host, "db-host", cfg.DB.Host, "database host")
+	fs.IntVar(&cfg.DB.Port, "db-port", cfg.DB.Port, "database port")
+	fs.StringVar(&cfg.DB.User, "db-user", cfg.DB.User, "database user")
+	fs.StringVar(&cfg.DB.Password, "db-password", cfg.DB.Password, "database password")
+	fs.StringVar(&cfg.DB.Name, "db-name", cfg.DB.Name, "database name")
+	fs.BoolVar(&cfg.DB.AutoMigrate, "db-auto-migrate", cfg.DB.AutoMigrate, "apply pending schema migrations at startup")
+	fs.DurationVar((*time.Duration)(&cfg.DB.QueryTimeout), "db-query-timeout", time.Duration(cfg.DB.QueryTimeout), "maximum duration of each database query, 0 for none")
+	fs.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", cfg.DB.MaxOpenConns, "maximum number of open database connexions, 0 for no limit")
+	fs.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", cfg.DB.MaxIdleConns, "maximum number of idle database connexions")
+	fs.DurationVar((*time.Duration)(&cfg.DB.ConnMaxLifetime), "db-conn-max-lifetime", time.Duration(cfg.DB.ConnMaxLifetime), "maximum time a database connexion is reused, 0 for no limit")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "minimum level of logs: debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "format of logs: json or text")
+	fs.StringVar(&cfg.Tracing.Exporter, "tracing-exporter", cfg.Tracing.Exporter, "where traces are sent: none, otlp or stdout")
+	fs.StringVar(&cfg.Tracing.Endpoint, "tracing-endpoint", cfg.Tracing.Endpoint, "URL of the OTLP/HTTP trace collector")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", cfg.Tracing.SampleRatio, "fraction of new traces which are sampled, between 0 and 1")
+	return fs
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Environment variables and how they are applied to the config
+var envVars = []struct {
+	name  string
+	apply func(cfg *Config, value string) error
+}{
+	{"LISTEN_ADDR", func(cfg *Config, v string) error { cfg.ListenAddr = v; return nil }},
+	{"ADMIN_LISTEN_ADDR", func(cfg *Config, v string) error { cfg.AdminListenAddr = v; return nil }},
+	{"CORS_ORIGINS", func(cfg *Config, v string) error { return (*listValue)(&cfg.CORSOrigins).Set(v) }},
+	{"READ_TIMEOUT", func(cfg *Config, v string) error { return cfg.ReadTimeout.Set(v) }},
+	{"WRITE_TIMEOUT", func(cfg *Config, v string) error { return cfg.WriteTimeout.Set(v) }},
+	{"IDLE_TIMEOUT", func(cfg *Config, v string) error { return cfg.IdleTimeout.Set(v) }},
+	{"SHUTDOWN_TIMEOUT", func(cfg *Config, v string) error { return cfg.ShutdownTimeout.Set(v) }},
+	{"ACCESS_TOKEN_TTL", func(cfg *Config, v string) error { return cfg.AccessTokenTTL.Set(v) }},
+	{"REFRESH_TOKEN_TTL", func(cfg *Config, v string) error { return cfg.RefreshTokenTTL.Set(v) }},
+	{"DB_HOST", func(cfg *Config, v string) error { cfg.DB.Host = v; return nil }},
+	{"DB_PORT", func(cfg *Config, v string) error { return setInt(&cfg.DB.Port, v) }},
+	{"DB_USER", func(cfg *Config, v string) error { cfg.DB.User = v; return nil }},
+	{"DB_PASSWORD", func(cfg *Config, v string) error { cfg.DB.Password = v; return nil }},
+	{"DB_NAME", func(cfg *Config, v string) error { cfg.DB.Name = v; return nil }},
+	{"DB_AUTO_MIGRATE", func(cfg *Config, v string) error { return setBool(&cfg.DB.AutoMigrate, v) }},
+	{"DB_QUERY_TIMEOUT", func(cfg *Config, v string) error { return cfg.DB.QueryTimeout.Set(v) }},
+	{"DB_MAX_OPEN_CONNS", func(cfg *Config, v string) error { return setInt(&cfg.DB.MaxOpenConns, v) }},
+	{"DB_MAX_IDLE_CONNS", func(cfg *Config, v string) error { return setInt(&cfg.DB.MaxIdleConns, v) }},
+	{"DB_CONN_MAX_LIFETIME", func(cfg *Config, v string) error { return cfg.DB.ConnMaxLifetime.Set(v) }},
+	{"LOG_LEVEL", func(cfg *Config, v string) error { cfg.Log.Level = v; return nil }},
+	{"LOG_FORMAT", func(cfg *Config, v string) error { cfg.Log.Format = v; return nil }},
+	{"TRACING_EXPORTER", func(cfg *Config, v string) error { cfg.Tracing.Exporter = v; return nil }},
+	{"TRACING_ENDPOINT", func(cfg *Config, v string) error { cfg.Tracing.Endpoint = v; return nil }},
+	{"TRACING_SAMPLE_RATIO", func(cfg *Config, v string) error { return setFloat(&cfg.Tracing.SampleRatio, v) }},
+}
+
+func loadEnv(cfg *Config, getenv func(string) string) error {
+	for _, env := range envVars {
+		value := getenv(envPrefix + env.name)
+		if value == "" {
+			continue
+		}
+		if err := env.apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid value for %s%s: %w", envPrefix, env.name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the configuration can be used to start the server
+func (c *Config) Validate() error {
+	var errs []string
+	if c.ListenAddr == "" {
+		errs = append(errs, "listen address cannot be empty")
+	} else if c.AdminListenAddr == c.ListenAddr {
+		errs = append(errs, "admin listen address must differ from listen address")
+	}
+	if len(c.CORSOrigins) == 0 {
+		errs = append(errs, "at least one CORS origin is required")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		errs = append(errs, "HTTP timeouts cannot be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, "shutdown timeout must be positive")
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		errs = append(errs, "token lifetimes must be positive")
+	} else if c.RefreshTokenTTL < c.AccessTokenTTL {
+		errs = append(errs, "refresh tokens cannot expire before access tokens")
+	}
+	if c.DB.Host == "" {
+		errs = append(errs, "database host cannot be empty")
+	}
+	if c.DB.Port <= 0 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("database port %d is out of range", c.DB.Port))
+	}
+	if c.DB.User == "" {
+		errs = append(errs, "database user cannot be empty")
+	}
+	if c.DB.Name == "" {
+		errs = append(errs, "database name cannot be empty")
+	}
+	if c.DB.QueryTimeout < 0 || c.DB.ConnMaxLifetime < 0 {
+		errs = append(errs, "database timeouts cannot be negative")
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		errs = append(errs, "database connexion limits cannot be negative")
+	} else if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		errs = append(errs, "database idle connexions cannot exceed open connexions")
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Sprintf("unknown log level %q", c.Log.Level))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Sprintf("unknown log format %q", c.Log.Format))
+	}
+	switch strings.ToLower(c.Tracing.Exporter) {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Sprintf("unknown trace exporter %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, "trace sample ratio must be between 0 and 1")
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func setInt(dst *int, value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dst = i
+	return nil
+}
+
+func setFloat(dst *float64, value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*dst = f
+	return nil
+}
+
+// Duration is a time.Duration written as a string ("10s", "2m") in the config file
+type Duration time.Duration
+
+func (d *Duration) Set(value string) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	return d.Set(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func setBool(dst *bool, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+// listValue is a flag.Value for comma separated lists
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*l = list
+	return nil
+}
@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Thybaau/todolist-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Error while loading config : %s", err)
+	}
+	assert.Equal(t, config.Default(), cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"listen_addr": ":8000", "read_timeout": "5s", "db": {"host": "file-host", "port": 5433, "name": "file_db"}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Error while writing config file : %s", err)
+	}
+
+	getenv := env(map[string]string{
+		"TODOLIST_CONFIG":       path,
+		"TODOLIST_DB_HOST":      "env-host",
+		"TODOLIST_DB_PASSWORD":  "secret",
+		"TODOLIST_CORS_ORIGINS": "http://a.example, http://b.example",
+	})
+	cfg, err := config.Load([]string{"-db-host", "flag-host"}, getenv)
+	if err != nil {
+		t.Fatalf("Error while loading config : %s", err)
+	}
+
+	assert.Equal(t, ":8000", cfg.ListenAddr)
+	assert.Equal(t, config.Duration(5*time.Second), cfg.ReadTimeout)
+	assert.Equal(t, []string{"http://a.example", "http://b.example"}, cfg.CORSOrigins)
+	assert.Equal(t, "flag-host", cfg.DB.Host)
+	assert.Equal(t, 5433, cfg.DB.Port)
+	assert.Equal(t, "postgres", cfg.DB.User)
+	assert.Equal(t, "secret", cfg.DB.Password)
+	assert.Equal(t, "file_db", cfg.DB.Name)
+}
+
+func TestLoadUnknownFileField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"listen": ":8000"}`), 0o600); err != nil {
+		t.Fatalf("Error while writing config file : %s", err)
+	}
+
+	_, err := config.Load([]string{"-config", path}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := config.Load(nil, env(map[string]string{"TODOLIST_DB_PORT": "abc"}))
+	assert.EqualError(t, err, `invalid value for TODOLIST_DB_PORT: strconv.Atoi: parsing "abc": invalid syntax`)
+
+	_, err = config.Load([]string{"-db-port", "70000", "-db-name", ""}, env(nil))
+	assert.EqualError(t, err, "invalid configuration: database port 70000 is out of range, database name cannot be empty")
+
+	_, err = config.Load([]string{"-db-max-open-conns", "2", "-db-max-idle-conns", "5", "-db-query-timeout", "-1s"}, env(nil))
+	assert.EqualError(t, err, "invalid configuration: database timeouts cannot be negative, database idle connexions cannot exceed open connexions")
+
+	_, err = config.Load([]string{"-admin-listen", ":9000"}, env(nil))
+	assert.EqualError(t, err, "invalid configuration: admin listen address must differ from listen address")
+
+	_, err = config.Load([]string{"-log-format", "xml"}, env(map[string]string{"TODOLIST_LOG_LEVEL": "verbose"}))
+	assert.EqualError(t, err, `invalid configuration: unknown log level "verbose", unknown log format "xml"`)
+
+	_, err = config.Load([]string{"-tracing-sample-ratio", "1.5"}, env(map[string]string{"TODOLIST_TRACING_EXPORTER": "jaeger"}))
+	assert.EqualError(t, err, `invalid configuration: unknown trace exporter "jaeger", trace sample ratio must be between 0 and 1`)
+}
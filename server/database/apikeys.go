@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey is a long-lived credential used by scripts instead of a session
+type APIKey struct {
+	ID         int64      `db:"id"`
+	UserID     int64      `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scope      string     `db:"scope"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+}
+
+func (store *DBStore) CreateAPIKey(ctx context.Context, k *APIKey) (id int64, err error) {
+	ctx, end := store.begin(ctx, "CreateAPIKey")
+	defer func() { end(err) }()
+
+	err = store.DB.QueryRowContext(ctx, "INSERT INTO api_keys (user_id,name,prefix,key_hash,scope) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		k.UserID, k.Name, k.Prefix, k.KeyHash, k.Scope).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return k.ID, nil
+}
+
+// ListAPIKeys returns the keys of a user that were not revoked
+func (store *DBStore) ListAPIKeys(ctx context.Context, userID int64) (keys []*APIKey, err error) {
+	ctx, end := store.begin(ctx, "ListAPIKeys")
+	defer func() { end(err) }()
+
+	rows, err := store.DB.QueryContext(ctx, `SELECT id, user_id, name, prefix, scope, created_at, last_used_at FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys = []*APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scope, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// UseAPIKey returns the key matching hash and records its use,
+// ErrNotFound if the key is unknown or revoked
+func (store *DBStore) UseAPIKey(ctx context.Context, hash string) (key *APIKey, err error) {
+	ctx, end := store.begin(ctx, "UseAPIKey")
+	defer func() { end(err) }()
+
+	row := store.DB.QueryRowContext(ctx, `UPDATE api_keys SET last_used_at = now()
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING id, user_id, name, prefix, scope, created_at, last_used_at`, hash)
+
+	k := APIKey{KeyHash: hash}
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scope, &k.CreatedAt, &k.LastUsedAt); err != nil {
+		return nil, notFound(err, "API key not found")
+	}
+	return &k, nil
+}
+
+func (store *DBStore) RevokeAPIKey(ctx context.Context, userID int64, keyID int) (err error) {
+	ctx, end := store.begin(ctx, "RevokeAPIKey")
+	defer func() { end(err) }()
+
+	result, err := store.DB.ExecContext(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", keyID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return newError(ErrNotFound, "API key %d not found", keyID)
+	}
+	return nil
+}
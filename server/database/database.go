@@ -1,56 +1,218 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/Thybaau/todolist-app/logging"
+	"github.com/lib/pq"
 )
 
 type Database interface {
-	Connect(host string, port int, user, password, dbname string) error
+	Connect(ctx context.Context, host string, port int, user, password, dbname string) error
 	Close() error
-	GetTaskList() ([]*Task, error)
-	GetTask(id int) (*Task, error)
-	CreateTask(t *Task) (int64, error)
-	DeleteTask(taskID int) error
-	EditTask(taskID int, content string) error
-	ChangeTaskState(taskID int) (*Task, error)
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (current, latest int, err error)
+	CreateUser(ctx context.Context, u *User) (int64, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	CreateSession(ctx context.Context, s *Session) (int64, error)
+	GetSessionByAccessToken(ctx context.Context, hash string) (*Session, error)
+	RefreshSession(ctx context.Context, oldRefreshHash string, s *Session) error
+	RevokeSession(ctx context.Context, sessionID int64) error
+	CreateAPIKey(ctx context.Context, k *APIKey) (int64, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]*APIKey, error)
+	UseAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, keyID int) error
+	GetTaskList(ctx context.Context, userID int64, q TaskQuery) (*TaskPage, error)
+	GetTask(ctx context.Context, userID int64, id int) (*Task, error)
+	CreateTask(ctx context.Context, t *Task) (int64, error)
+	DeleteTask(ctx context.Context, userID int64, taskID int, version int64, promoteChildren bool) error
+	EditTask(ctx context.Context, t *Task) error
+	UpdateTask(ctx context.Context, userID int64, taskID int, patch TaskPatch) (*Task, error)
+	SetTaskState(ctx context.Context, userID int64, taskID int, version int64, state bool) (*Task, error)
+	ChangeTaskState(ctx context.Context, userID int64, taskID int, version int64) (*Task, error)
+	GetTaskTree(ctx context.Context, userID int64, taskID int) ([]*Task, error)
+	AddTaskDependency(ctx context.Context, userID int64, blockerID, taskID int) error
+	RemoveTaskDependency(ctx context.Context, userID int64, blockerID, taskID int) error
+	GetDependencyGraph(ctx context.Context, userID int64, taskID int) (*DependencyGraph, error)
+	CreateList(ctx context.Context, l *List) (int64, error)
+	GetLists(ctx context.Context, userID int64) ([]*List, error)
+	GetList(ctx context.Context, userID int64, id int) (*List, error)
+	EditList(ctx context.Context, l *List) error
+	DeleteList(ctx context.Context, userID int64, listID int) error
+	GetTags(ctx context.Context, userID int64) ([]*Tag, error)
+	AddTaskTag(ctx context.Context, userID int64, taskID int, version int64, tag string) (*Task, error)
+	RemoveTaskTag(ctx context.Context, userID int64, taskID int, version int64, tag string) (*Task, error)
 }
 
 type DBStore struct {
 	DB *sql.DB
+	// Apply pending migrations when connecting
+	AutoMigrate bool
+	// Maximum duration of each method, none if 0
+	QueryTimeout time.Duration
+	// Connexion pool settings, see the matching sql.DB methods
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// Called around every method call, to measure or trace them
+	Hooks []QueryHook
+}
+
+// QueryHook is called when a method of the store starts, with the name of the
+// method. It returns the context of the call and a function called with the
+// error of the method when it returns.
+type QueryHook func(ctx context.Context, method string) (context.Context, func(error))
+
+// withTimeout bounds ctx by the query timeout of the store
+func (store *DBStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if store.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, store.QueryTimeout)
+}
+
+// begin starts a call to a method of the store, bounded by its query timeout.
+// The returned function must be called with the error of the method once it
+// returns, to run the end of the hooks and log the call with the logger of ctx.
+func (store *DBStore) begin(ctx context.Context, method string) (context.Context, func(error)) {
+	ends := make([]func(error), len(store.Hooks))
+	for i, hook := range store.Hooks {
+		ctx, ends[i] = hook(ctx, method)
+	}
+	ctx, cancel := store.withTimeout(ctx)
+	start := time.Now()
+	return ctx, func(err error) {
+		cancel()
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+		logger := logging.FromContext(ctx)
+		level := slog.LevelDebug
+		attrs := []any{"method", method, "duration", time.Since(start)}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+			// Domain errors are expected, others are failures of the database
+			var domainErr *Error
+			if !errors.As(err, &domainErr) {
+				level = slog.LevelError
+			}
+		}
+		logger.Log(ctx, level, "Database call", attrs...)
+	}
 }
 
 // Tasks structs
 type Task struct {
-	ID      int64  `db:"id"`
-	Content string `db:"content"`
-	State   bool   `db:"state"`
+	ID     int64 `db:"id"`
+	UserID int64 `db:"user_id"`
+	// List of the task, none if nil
+	ListID      *int64     `db:"list_id"`
+	Content     string     `db:"content"`
+	Description string     `db:"description"`
+	State       bool       `db:"state"`
+	Priority    Priority   `db:"priority"`
+	DueAt       *time.Time `db:"due_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+	CompletedAt *time.Time `db:"completed_at"`
+	// Incremented by every update of the task
+	Version int64 `db:"version"`
+	// Names of the tags of the task, sorted
+	Tags []string `db:"-"`
+	// Parent of a subtask, nil for top level tasks
+	ParentID *int64 `db:"parent_id"`
+	// Complete the task when all its subtasks are done
+	AutoComplete bool `db:"auto_complete"`
+	// Number of direct subtasks, and of those done, not stored
+	Subtasks     int64 `db:"-"`
+	DoneSubtasks int64 `db:"-"`
+	// Recurrence rule of a recurring task, empty otherwise
+	Recurrence string `db:"recurrence"`
+	// Set by the methods changing the state of a task when their call
+	// completed it, not stored
+	JustCompleted bool `db:"-"`
+	// Numbers of parents auto completed and of next occurrences created by
+	// the same call, not stored
+	CompletedParents   int `db:"-"`
+	CreatedOccurrences int `db:"-"`
+}
+
+// Columns read by scanTask, in order
+const taskColumns = "id, user_id, list_id, content, description, state, priority, due_at, created_at, updated_at, completed_at, version, " +
+	taskTagsColumn + ", parent_id, auto_complete, " + subtaskCountsColumns + ", recurrence"
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Columns read by scanTaskChange : the task, then whether the statement
+// returning it completed it
+const taskChangeColumns = taskColumns + ", state AND completed_at = now()"
+
+func scanTask(row scanner) (*Task, error) {
+	var t Task
+	if err := row.Scan(taskFields(&t)...); err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
-type CustomError struct {
-	Message string
+func scanTaskChange(row scanner) (*Task, error) {
+	var t Task
+	if err := row.Scan(append(taskFields(&t), &t.JustCompleted)...); err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
-func (e *CustomError) Error() string {
-	return fmt.Sprintf("Error : %s", e.Message)
+// taskFields returns the destinations of taskColumns in t
+func taskFields(t *Task) []interface{} {
+	return []interface{}{&t.ID, &t.UserID, &t.ListID, &t.Content, &t.Description, &t.State, &t.Priority,
+		&t.DueAt, &t.CreatedAt, &t.UpdatedAt, &t.CompletedAt, &t.Version, pq.Array(&t.Tags),
+		&t.ParentID, &t.AutoComplete, &t.Subtasks, &t.DoneSubtasks, &t.Recurrence}
 }
 
-func (store *DBStore) Connect(host string, port int, user, password, dbname string) error {
+// ErrVersionMismatch is returned when a task was modified since the version
+// expected by an update
+var ErrVersionMismatch = newError(ErrConflict, "task was modified by another request")
+
+func (store *DBStore) Connect(ctx context.Context, host string, port int, user, password, dbname string) error {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return err
 	}
+	db.SetMaxOpenConns(store.MaxOpenConns)
+	db.SetMaxIdleConns(store.MaxIdleConns)
+	db.SetConnMaxLifetime(store.ConnMaxLifetime)
+
 	// Ping to check connection
-	err = db.Ping()
+	pingCtx, cancel := store.withTimeout(ctx)
+	defer cancel()
+	err = db.PingContext(pingCtx)
 	if err != nil {
+		db.Close()
 		return err
 	}
-	log.Printf("Connected to Postgre DB %s", dbname)
+	logging.FromContext(ctx).Info("Connected to PostgreSQL", "database", dbname)
 	store.DB = db
+
+	if store.AutoMigrate {
+		migrator, err := NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Up(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -58,52 +220,49 @@ func (store *DBStore) Close() error {
 	return store.DB.Close()
 }
 
-func (store *DBStore) GetTaskList() ([]*Task, error) {
-	rows, err := store.DB.Query("SELECT id, content, state FROM tasks")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// Add values to each Task structs and return list of structs
-	var tasks []*Task
-	for rows.Next() {
-		var t Task
-		if err := rows.Scan(&t.ID, &t.Content, &t.State); err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, &t)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return tasks, nil
+func (store *DBStore) GetTask(ctx context.Context, userID int64, id int) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "GetTask")
+	defer func() { end(err) }()
 
+	row := store.DB.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 AND user_id = $2", id, userID)
+	task, err = scanTask(row)
+	return task, notFound(err, "task %d not found", id)
 }
-func (store *DBStore) GetTask(id int) (*Task, error) {
-	row := store.DB.QueryRow("SELECT id, content, state FROM tasks WHERE id = $1", id)
 
-	var task Task
-	if err := row.Scan(&task.ID, &task.Content, &task.State); err != nil {
-		return nil, err
+// CreateTask inserts t and sets its ID, timestamps and version
+func (store *DBStore) CreateTask(ctx context.Context, t *Task) (id int64, err error) {
+	ctx, end := store.begin(ctx, "CreateTask")
+	defer func() { end(err) }()
+
+	err = insertTask(ctx, store.DB, t)
+	if err != nil {
+		return 0, taskListError(taskParentError(err, t.ParentID), t.ListID)
 	}
+	return t.ID, err
+}
 
-	return &task, nil
+// insertTask inserts t and sets its ID, timestamps and version
+func insertTask(ctx context.Context, q querier, t *Task) error {
+	return q.QueryRowContext(ctx, `INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, updated_at, version`,
+		t.UserID, t.ListID, t.Content, t.Description, t.State, t.Priority, t.DueAt, t.ParentID, t.AutoComplete, t.Recurrence).
+		Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt, &t.Version)
 }
 
-func (store *DBStore) CreateTask(t *Task) (int64, error) {
-	var id int64
-	err := store.DB.QueryRow("INSERT INTO tasks (content,state) VALUES ($1, $2) RETURNING id", t.Content, t.State).Scan(&id)
-	if err != nil {
-		return 0, err
+// DeleteTask deletes a task with its subtasks, or after moving its subtasks
+// to its parent if promoteChildren is true. When version is not 0, the task
+// is only deleted if it still has this version, or ErrVersionMismatch is
+// returned.
+func (store *DBStore) DeleteTask(ctx context.Context, userID int64, taskID int, version int64, promoteChildren bool) (err error) {
+	ctx, end := store.begin(ctx, "DeleteTask")
+	defer func() { end(err) }()
+
+	if promoteChildren {
+		return store.deleteTaskPromotingChildren(ctx, userID, taskID, version)
 	}
-	return id, err
-}
 
-func (store *DBStore) DeleteTask(taskID int) error {
-	result, err := store.DB.Exec("DELETE FROM tasks WHERE id = $1", taskID)
+	result, err := store.DB.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1 AND user_id = $2 AND ($3 = 0 OR version = $3)",
+		taskID, userID, version)
 	if err != nil {
 		return err
 	}
@@ -114,41 +273,215 @@ func (store *DBStore) DeleteTask(taskID int) error {
 		return err
 	}
 
-	// If no lines affected, it means ID didn't exist
+	// If no lines affected, it means ID didn't exist, or had another version
 	if rowsAffected == 0 {
-		return fmt.Errorf("task with ID %d does not exist", taskID)
+		if err := store.checkVersion(ctx, userID, taskID, version); err != nil {
+			return err
+		}
+		return newError(ErrNotFound, "task %d not found", taskID)
+	}
+	return nil
+}
+
+// EditTask replaces the content, description, priority and due date of
+// the task t.ID owned by t.UserID, and sets the other fields of t to the
+// updated task. When t.Version is not 0, the task is only changed if it still
+// has this version, or ErrVersionMismatch is returned.
+func (store *DBStore) EditTask(ctx context.Context, t *Task) (err error) {
+	ctx, end := store.begin(ctx, "EditTask")
+	defer func() { end(err) }()
+
+	query := `UPDATE tasks SET content = $1, description = $2, priority = $3, due_at = $4,
+		updated_at = now(), version = version + 1
+		WHERE id = $5 AND user_id = $6 AND ($7 = 0 OR version = $7) RETURNING ` + taskColumns
+	task, err := scanTask(store.DB.QueryRowContext(ctx, query,
+		t.Content, t.Description, t.Priority, t.DueAt, t.ID, t.UserID, t.Version))
+	if err == sql.ErrNoRows {
+		if err := store.checkVersion(ctx, t.UserID, int(t.ID), t.Version); err != nil {
+			return err
+		}
 	}
+	if err != nil {
+		return notFound(err, "task %d not found", t.ID)
+	}
+	*t = *task
 	return nil
 }
 
-func (store *DBStore) EditTask(taskID int, content string) error {
-	// Check if the row with the specified ID exists
+// checkVersion tells why a conditional statement on a task changed nothing :
+// it returns ErrVersionMismatch if the task exists while an other version
+// was expected, and nil otherwise
+func (store *DBStore) checkVersion(ctx context.Context, userID int64, taskID int, version int64) error {
+	if version == 0 {
+		return nil
+	}
 	var exists bool
-	err := store.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&exists)
+	err := store.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)", taskID, userID).Scan(&exists)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		// ID not found, return a custom error
-		err = &CustomError{
-			Message: fmt.Sprintf("row with ID %d not found", taskID),
+	if exists {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// TaskPatch lists the fields of a task to change, nil fields are left as is
+type TaskPatch struct {
+	Content     *string
+	Description *string
+	Priority    *Priority
+	State       *bool
+	// DueAt is only changed when SetDueAt is true, a nil DueAt removing the due date
+	SetDueAt bool
+	DueAt    *time.Time
+	// ListID is only changed when SetListID is true, a nil ListID moving the
+	// task out of its list
+	SetListID bool
+	ListID    *int64
+	// ParentID is only changed when SetParentID is true, a nil ParentID
+	// moving the task to the top level
+	SetParentID  bool
+	ParentID     *int64
+	AutoComplete *bool
+	// An empty Recurrence makes the task not recurring
+	Recurrence *string
+	// When not 0, the task is only changed if it still has this version
+	Version int64
+}
+
+// Empty reports whether the patch does not change anything
+func (p TaskPatch) Empty() bool {
+	return p.Content == nil && p.Description == nil && p.Priority == nil && p.State == nil && !p.SetDueAt && !p.SetListID &&
+		!p.SetParentID && p.AutoComplete == nil && p.Recurrence == nil
+}
+
+// UpdateTask applies patch to a task in a single statement and returns the
+// updated task, ErrNotFound if it does not exist, ErrVersionMismatch if it
+// does not have patch.Version or ErrConflict if it is completed while
+// blocked
+func (store *DBStore) UpdateTask(ctx context.Context, userID int64, taskID int, patch TaskPatch) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "UpdateTask")
+	defer func() { end(err) }()
+
+	set := []string{"updated_at = now()", "version = version + 1"}
+	args := []interface{}{}
+	add := func(column string, value interface{}) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if patch.Content != nil {
+		add("content", *patch.Content)
+	}
+	if patch.Description != nil {
+		add("description", *patch.Description)
+	}
+	if patch.Priority != nil {
+		add("priority", *patch.Priority)
+	}
+	if patch.SetDueAt {
+		add("due_at", patch.DueAt)
+	}
+	if patch.SetListID {
+		add("list_id", patch.ListID)
+	}
+	var before func(q querier) error
+	if patch.SetParentID {
+		if patch.ParentID != nil {
+			before = func(q querier) error {
+				return checkParent(ctx, q, userID, taskID, *patch.ParentID)
+			}
 		}
-		return err
+		add("parent_id", patch.ParentID)
+	}
+	if patch.AutoComplete != nil {
+		add("auto_complete", *patch.AutoComplete)
+	}
+	if patch.Recurrence != nil {
+		add("recurrence", *patch.Recurrence)
 	}
-	_, err = store.DB.Exec("UPDATE tasks SET content = $1 WHERE id = $2", content, taskID)
-	return err
+	where := ""
+	if patch.State != nil {
+		if *patch.State {
+			where = " AND (state OR " + notBlocked + ")"
+		}
+		add("state", *patch.State)
+		// Completing an already done task keeps its completion date
+		set = append(set, fmt.Sprintf("completed_at = CASE WHEN $%d THEN COALESCE(completed_at, now()) END", len(args)))
+	}
+
+	args = append(args, taskID, userID, patch.Version)
+	query := fmt.Sprintf("UPDATE tasks SET %s WHERE id = $%d AND user_id = $%d AND ($%d = 0 OR version = $%d)%s RETURNING %s",
+		strings.Join(set, ", "), len(args)-2, len(args)-1, len(args), len(args), where, taskChangeColumns)
+	task, err = store.changeTaskState(ctx, where != "", before, query, args...)
+	if patch.SetParentID {
+		err = taskParentError(err, patch.ParentID)
+	}
+	if patch.SetListID {
+		err = taskListError(err, patch.ListID)
+	}
+	if err == sql.ErrNoRows {
+		if err := store.checkVersion(ctx, userID, taskID, patch.Version); err != nil {
+			return nil, err
+		}
+		if where != "" {
+			if err := store.checkBlockers(ctx, userID, taskID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return task, notFound(err, "task %d not found", taskID)
 }
 
-func (store *DBStore) ChangeTaskState(taskID int) (*Task, error) {
-	task, err := store.GetTask(taskID)
-	if err != nil {
-		return nil, err
+// SetTaskState sets the state of a task in a single statement, and returns
+// the task, ErrNotFound if it does not exist, ErrVersionMismatch if it does
+// not have version when not 0 or ErrConflict if it is completed while
+// blocked. Setting the state a task already has changes nothing, so that
+// retries are idempotent.
+func (store *DBStore) SetTaskState(ctx context.Context, userID int64, taskID int, version int64, state bool) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "SetTaskState")
+	defer func() { end(err) }()
+
+	query := `UPDATE tasks SET state = $1,
+		completed_at = CASE WHEN $1 THEN COALESCE(completed_at, now()) END,
+		updated_at = CASE WHEN state = $1 THEN updated_at ELSE now() END,
+		version = CASE WHEN state = $1 THEN version ELSE version + 1 END
+		WHERE id = $2 AND user_id = $3 AND ($4 = 0 OR version = $4) AND (NOT $1 OR state OR ` + notBlocked + `)
+		RETURNING ` + taskChangeColumns
+	task, err = store.changeTaskState(ctx, state, nil, query, state, taskID, userID, version)
+	if err == sql.ErrNoRows {
+		if err := store.checkVersion(ctx, userID, taskID, version); err != nil {
+			return nil, err
+		}
+		if state {
+			if err := store.checkBlockers(ctx, userID, taskID); err != nil {
+				return nil, err
+			}
+		}
 	}
-	newState := !task.State
-	_, err = store.DB.Exec("UPDATE tasks SET state = $1 WHERE id = $2", newState, taskID)
-	if err != nil {
-		return nil, err
+	return task, notFound(err, "task %d not found", taskID)
+}
+
+// ChangeTaskState toggles the state of a task in a single statement. It
+// returns ErrVersionMismatch if the task does not have version when not 0,
+// or ErrConflict if it is completed while blocked.
+func (store *DBStore) ChangeTaskState(ctx context.Context, userID int64, taskID int, version int64) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "ChangeTaskState")
+	defer func() { end(err) }()
+
+	query := `UPDATE tasks SET state = NOT state,
+		completed_at = CASE WHEN state THEN NULL ELSE now() END,
+		updated_at = now(), version = version + 1
+		WHERE id = $1 AND user_id = $2 AND ($3 = 0 OR version = $3) AND (state OR ` + notBlocked + `)
+		RETURNING ` + taskChangeColumns
+	task, err = store.changeTaskState(ctx, true, nil, query, taskID, userID, version)
+	if err == sql.ErrNoRows {
+		if err := store.checkVersion(ctx, userID, taskID, version); err != nil {
+			return nil, err
+		}
+		if err := store.checkBlockers(ctx, userID, taskID); err != nil {
+			return nil, err
+		}
 	}
-	task, err = store.GetTask(taskID)
-	return task, err
+	return task, notFound(err, "task %d not found", taskID)
 }
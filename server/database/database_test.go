@@ -1,19 +1,57 @@
 package database_test
 
 import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
 	"fmt"
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/logging"
 	"github.com/Thybaau/todolist-app/router"
 )
 
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// Columns selected by the queries returning tasks
+const selectedTaskColumns = "id, user_id, list_id, content, description, state, priority, due_at, created_at, updated_at, completed_at, version, " +
+	"ARRAY(SELECT tags.name FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE task_tags.task_id = tasks.id ORDER BY tags.name), parent_id, auto_complete, " +
+	"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id), " +
+	"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.state), recurrence"
+
+// Condition of the queries completing a task on its blockers
+const notBlocked = "NOT EXISTS (SELECT 1 FROM task_dependencies JOIN tasks AS blockers ON blockers.id = task_dependencies.blocker_id " +
+	"WHERE task_dependencies.task_id = tasks.id AND NOT blockers.state)"
+
+var taskColumns = []string{"id", "user_id", "list_id", "content", "description", "state", "priority", "due_at", "created_at", "updated_at", "completed_at", "version", "tags",
+	"parent_id", "auto_complete", "subtasks", "done_subtasks", "recurrence"}
+
+// taskValues returns a task row of user 7 without any details
+func taskValues(id int, content string, state bool) []driver.Value {
+	var completedAt interface{}
+	if state {
+		completedAt = testTime
+	}
+	return []driver.Value{id, 7, nil, content, "", state, 0, nil, testTime, testTime, completedAt, 1, "{}", nil, false, 0, 0, ""}
+}
+
+// Columns returned by the methods changing the state of a task
+var taskChangeColumns = append(taskColumns[:len(taskColumns):len(taskColumns)], "completed_now")
+
+// taskChangeValues returns a row of taskChangeColumns
+func taskChangeValues(id int, content string, state, completedNow bool) []driver.Value {
+	return append(taskValues(id, content, state), completedNow)
+}
+
 func TestGetTaskList(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -24,20 +62,26 @@ func TestGetTaskList(t *testing.T) {
 	srv := router.NewServer()
 	srv.DB = &database.DBStore{DB: db}
 
-	rows := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(1, "Task 1", false).
-		AddRow(2, "Task 2", false)
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(1, "Task 1", false)...).
+		AddRow(taskValues(2, "Task 2", false)...)
 
-	mock.ExpectQuery("SELECT id, content, state FROM tasks").WillReturnRows(rows)
+	count := "SELECT COUNT(*) FROM tasks WHERE user_id = $1"
+	mock.ExpectQuery(regexp.QuoteMeta(count)).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE user_id = $1 ORDER BY id ASC LIMIT 101"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(7).WillReturnRows(rows)
 
-	tasks, err := srv.DB.GetTaskList()
+	page, err := srv.DB.GetTaskList(context.Background(), 7, database.TaskQuery{})
 	if err != nil {
 		t.Fatalf("Error while executing GetTaskList : %s", err)
 	}
+	tasks := page.Tasks
+	assert.Equal(t, int64(2), page.Total)
+	assert.Empty(t, page.NextCursor)
 
 	expectedTasks := []*database.Task{
-		{ID: 1, Content: "Task 1", State: false},
-		{ID: 2, Content: "Task 2", State: false},
+		{ID: 1, UserID: 7, Content: "Task 1", State: false, CreatedAt: testTime, UpdatedAt: testTime, Version: 1, Tags: []string{}},
+		{ID: 2, UserID: 7, Content: "Task 2", State: false, CreatedAt: testTime, UpdatedAt: testTime, Version: 1, Tags: []string{}},
 	}
 
 	assert.Equal(t, expectedTasks, tasks, "Tasks does not correspond")
@@ -47,6 +91,73 @@ func TestGetTaskList(t *testing.T) {
 	}
 }
 
+func TestGetTaskListPages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	// First page, tasks without due date come last
+	dueAt := testTime.Add(time.Hour)
+	due := taskValues(3, "Task 3", false)
+	due[7] = dueAt
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND (content ILIKE $2 OR description ILIKE $2)")).
+		WithArgs(7, `%100\%%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY COALESCE(due_at, 'infinity') ASC, id ASC LIMIT 3")).
+		WithArgs(7, `%100\%%`).
+		WillReturnRows(sqlmock.NewRows(taskColumns).
+			AddRow(due...).
+			AddRow(taskValues(1, "Task 1", false)...).
+			AddRow(taskValues(2, "Task 2", false)...))
+
+	q := database.TaskQuery{Search: "100%", Sort: "due_at", Limit: 2}
+	page, err := store.GetTaskList(context.Background(), 7, q)
+	if err != nil {
+		t.Fatalf("Error while executing GetTaskList : %s", err)
+	}
+	assert.Len(t, page.Tasks, 2)
+	assert.Equal(t, int64(3), page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// Second page starts after the last task of the first one
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	next := "WHERE user_id = $1 AND (content ILIKE $2 OR description ILIKE $2) AND (COALESCE(due_at, 'infinity'), id) > ($3::timestamptz, $4) ORDER BY"
+	mock.ExpectQuery(regexp.QuoteMeta(next)).
+		WithArgs(7, `%100\%%`, "infinity", 1).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(2, "Task 2", false)...))
+
+	q.Cursor = page.NextCursor
+	page, err = store.GetTaskList(context.Background(), 7, q)
+	if err != nil {
+		t.Fatalf("Error while executing GetTaskList : %s", err)
+	}
+	assert.Len(t, page.Tasks, 1)
+	assert.Empty(t, page.NextCursor)
+
+	// A cursor cannot be used with another sort
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	q.Desc = true
+	_, err = store.GetTaskList(context.Background(), 7, q)
+	assert.ErrorIs(t, err, database.ErrInvalidCursor)
+
+	// Nor hold a value of another type than the sort field
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	q.Desc = false
+	q.Cursor = base64.RawURLEncoding.EncodeToString([]byte(`{"s":"due_at asc","v":"tomorrow","id":1}`))
+	_, err = store.GetTaskList(context.Background(), 7, q)
+	assert.ErrorIs(t, err, database.ErrInvalidCursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
 func TestGetTask(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -57,14 +168,14 @@ func TestGetTask(t *testing.T) {
 	srv := router.NewServer()
 	srv.DB = &database.DBStore{DB: db}
 
-	rows := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(1, "Task 1", false).
-		AddRow(2, "Task 2", false)
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(1, "Task 1", false)...).
+		AddRow(taskValues(2, "Task 2", false)...)
 
-	query := "SELECT id, content, state FROM tasks WHERE id = $1"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(1).WillReturnRows(rows)
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(1, 7).WillReturnRows(rows)
 
-	task, err := srv.DB.GetTask(1)
+	task, err := srv.DB.GetTask(context.Background(), 7, 1)
 	if err != nil {
 		t.Fatalf("Error while executing GetTask : %v", err)
 	}
@@ -72,7 +183,7 @@ func TestGetTask(t *testing.T) {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 
-	expectedTask := database.Task{ID: 1, Content: "Task 1", State: false}
+	expectedTask := database.Task{ID: 1, UserID: 7, Content: "Task 1", State: false, CreatedAt: testTime, UpdatedAt: testTime, Version: 1, Tags: []string{}}
 	assert.Equal(t, &expectedTask, task, "Task does not correspond")
 }
 
@@ -86,18 +197,23 @@ func TestCreateTask(t *testing.T) {
 	srv := router.NewServer()
 	srv.DB = &database.DBStore{DB: db}
 
+	dueAt := testTime.Add(48 * time.Hour)
 	task := &database.Task{
-		ID:      0,
-		Content: "test task",
-		State:   false,
+		ID:          0,
+		UserID:      7,
+		Content:     "test task",
+		Description: "longer description",
+		State:       false,
+		Priority:    database.PriorityLow,
+		DueAt:       &dueAt,
 	}
 
-	insert := "INSERT INTO tasks (content,state) VALUES ($1, $2) RETURNING id"
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, updated_at, version"
 	mock.ExpectQuery(regexp.QuoteMeta(insert)).
-		WithArgs(task.Content, task.State).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		WithArgs(task.UserID, task.ListID, task.Content, task.Description, task.State, task.Priority, task.DueAt, task.ParentID, task.AutoComplete, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(1, testTime, testTime, 1))
 
-	id, err := srv.DB.CreateTask(task)
+	id, err := srv.DB.CreateTask(context.Background(), task)
 	if err != nil {
 		t.Fatalf("Error while creating task : %s", err)
 	}
@@ -105,6 +221,8 @@ func TestCreateTask(t *testing.T) {
 	if id != 1 {
 		t.Fatalf("Bad task ID, wanted 1 but got %d", id)
 	}
+	assert.Equal(t, testTime, task.CreatedAt)
+	assert.Equal(t, int64(1), task.Version)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("Expectations were not met : %s", err)
@@ -121,10 +239,10 @@ func TestDeleteTask(t *testing.T) {
 	srv.DB = &database.DBStore{DB: db}
 
 	taskID := 12
-	delete := "DELETE FROM tasks WHERE id = \\$1"
-	mock.ExpectExec(delete).WithArgs(taskID).WillReturnResult(sqlmock.NewResult(1, 1))
+	delete := "DELETE FROM tasks WHERE id = \\$1 AND user_id = \\$2"
+	mock.ExpectExec(delete).WithArgs(taskID, 7, 0).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = srv.DB.DeleteTask(taskID)
+	err = srv.DB.DeleteTask(context.Background(), 7, taskID, 0, false)
 	if err != nil {
 		t.Errorf("Error while deleting task : %v", err)
 	}
@@ -140,14 +258,12 @@ func TestDeleteTaskBadID(t *testing.T) {
 	srv.DB = &database.DBStore{DB: db}
 
 	taskID := 12
-	delete := "DELETE FROM tasks WHERE id = \\$1"
-	mock.ExpectExec(delete).WithArgs(taskID).WillReturnResult(sqlmock.NewResult(0, 0))
+	delete := "DELETE FROM tasks WHERE id = \\$1 AND user_id = \\$2"
+	mock.ExpectExec(delete).WithArgs(taskID, 7, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err = srv.DB.DeleteTask(taskID)
-	expectedError := fmt.Sprintf("task with ID %d does not exist", taskID)
-	if err.Error() != expectedError {
-		t.Fatalf("Function DeleteTask returned bad error message")
-	}
+	err = srv.DB.DeleteTask(context.Background(), 7, taskID, 0, false)
+	assert.ErrorIs(t, err, database.ErrNotFound)
+	assert.EqualError(t, err, fmt.Sprintf("task %d not found", taskID))
 }
 
 func TestEditTask(t *testing.T) {
@@ -161,18 +277,41 @@ func TestEditTask(t *testing.T) {
 
 	taskID := 123
 	content := "task content"
-	query := "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(taskID).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-
-	mock.ExpectExec("UPDATE tasks SET content = \\$1 WHERE id = \\$2").
-		WithArgs(content, taskID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	err = srv.DB.EditTask(taskID, content)
+	values := taskValues(taskID, content, false)
+	values[6], values[11] = database.PriorityMedium, 2
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET content = $1, description = $2, priority = $3, due_at = $4, updated_at = now(), version = version + 1")).
+		WithArgs(content, "", database.PriorityMedium, nil, taskID, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+
+	task := &database.Task{ID: int64(taskID), UserID: 7, Content: content, Priority: database.PriorityMedium}
+	err = srv.DB.EditTask(context.Background(), task)
 	if err != nil {
 		t.Fatalf("Error while editing task : %v", err)
 	}
+	assert.Equal(t, int64(2), task.Version)
+	assert.Equal(t, testTime, task.UpdatedAt)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestEditTaskVersionMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET content = $1")).
+		WithArgs("new content", "", database.PriorityNone, nil, 123, 7, 3).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+	query := "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(123, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	err = store.EditTask(context.Background(), &database.Task{ID: 123, UserID: 7, Content: "new content", Version: 3})
+	assert.Equal(t, database.ErrVersionMismatch, err)
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
@@ -189,27 +328,28 @@ func TestChangeTaskState(t *testing.T) {
 
 	taskID := 12
 	state := true
-	query := "SELECT id, content, state FROM tasks WHERE id = \\$1"
-
-	rows1 := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(taskID, "Task 1", !state)
-	mock.ExpectQuery(query).WithArgs(taskID).WillReturnRows(rows1)
-
-	mock.ExpectExec("UPDATE tasks SET state = \\$1 WHERE id = \\$2").
-		WithArgs(state, taskID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	rows2 := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(taskID, "Task 1", state)
-	mock.ExpectQuery(query).WithArgs(taskID).WillReturnRows(rows2)
+	query := "UPDATE tasks SET state = NOT state, completed_at = CASE WHEN state THEN NULL ELSE now() END"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(taskID, "Task 1", state, true)...)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(taskID, 7, 0).WillReturnRows(rows)
+	mock.ExpectCommit()
 
 	expectedTask := &database.Task{
-		ID:      int64(taskID),
-		Content: "Task 1",
-		State:   state,
+		ID:          int64(taskID),
+		UserID:      7,
+		Content:     "Task 1",
+		State:       state,
+		CreatedAt:   testTime,
+		UpdatedAt:   testTime,
+		CompletedAt: &testTime,
+		Version:     1,
+		Tags:        []string{},
+		// Toggled from not done
+		JustCompleted: true,
 	}
 
-	task, err := srv.DB.ChangeTaskState(taskID)
+	task, err := srv.DB.ChangeTaskState(context.Background(), 7, taskID, 0)
 	if err != nil {
 		t.Fatalf("Error while changing task state : %v", err)
 	}
@@ -221,3 +361,160 @@ func TestChangeTaskState(t *testing.T) {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 }
+
+func TestSetTaskState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	query := "UPDATE tasks SET state = $1, completed_at = CASE WHEN $1 THEN COALESCE(completed_at, now()) END, " +
+		"updated_at = CASE WHEN state = $1 THEN updated_at ELSE now() END, " +
+		"version = CASE WHEN state = $1 THEN version ELSE version + 1 END WHERE id = $2 AND user_id = $3 " +
+		"AND ($4 = 0 OR version = $4) AND (NOT $1 OR state OR " + notBlocked + ") RETURNING " + selectedTaskColumns + ", " +
+		"state AND completed_at = now()"
+	// Completing twice returns the same task, only completed by the first call
+	for _, completedNow := range []bool{true, false} {
+		rows := sqlmock.NewRows(taskChangeColumns).
+			AddRow(taskChangeValues(12, "Task 1", true, completedNow)...)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(true, 12, 7, 0).WillReturnRows(rows)
+		mock.ExpectCommit()
+	}
+
+	for _, completedNow := range []bool{true, false} {
+		task, err := store.SetTaskState(context.Background(), 7, 12, 0, true)
+		if err != nil {
+			t.Fatalf("Error while setting task state : %v", err)
+		}
+		assert.True(t, task.State)
+		assert.Equal(t, &testTime, task.CompletedAt)
+		assert.Equal(t, completedNow, task.JustCompleted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestUpdateTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	content := "Task 1"
+	state := true
+	query := "UPDATE tasks SET updated_at = now(), version = version + 1, content = $1, due_at = $2, state = $3, " +
+		"completed_at = CASE WHEN $3 THEN COALESCE(completed_at, now()) END WHERE id = $4 AND user_id = $5 AND ($6 = 0 OR version = $6) " +
+		"AND (state OR " + notBlocked + ") RETURNING " + selectedTaskColumns + ", " +
+		"state AND completed_at = now()"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(12, content, state, true)...)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(content, nil, state, 12, 7, 0).
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	patch := database.TaskPatch{Content: &content, State: &state, SetDueAt: true}
+	task, err := store.UpdateTask(context.Background(), 7, 12, patch)
+	if err != nil {
+		t.Fatalf("Error while updating task : %v", err)
+	}
+	assert.Equal(t, content, task.Content)
+	assert.True(t, task.State)
+	assert.Equal(t, &testTime, task.CompletedAt)
+	assert.True(t, task.JustCompleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db, QueryTimeout: 10 * time.Millisecond}
+
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(1, 7).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(1, "Task 1", false)...))
+
+	start := time.Now()
+	_, err = store.GetTask(context.Background(), 7, 1)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "Query was not interrupted by the timeout")
+}
+
+func TestQueryCanceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM tasks")).
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The client went away before the end of the query
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = store.DeleteTask(ctx, 7, 1, 0, false)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCallsLoggedWithRequestLogger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "debug", "text")
+	ctx := logging.NewContext(context.Background(), logger.With("request_id", "abc"))
+
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(3, 7).WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	_, err = store.GetTask(ctx, 7, 3)
+	assert.ErrorIs(t, err, database.ErrNotFound)
+	assert.Contains(t, buf.String(), `level=DEBUG msg="Database call" request_id=abc method=GetTask`)
+	assert.Contains(t, buf.String(), `error="task 3 not found"`)
+}
+
+func TestQueryHooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+
+	var calls []string
+	hook := func(ctx context.Context, method string) (context.Context, func(error)) {
+		calls = append(calls, "begin "+method)
+		return ctx, func(err error) {
+			calls = append(calls, fmt.Sprintf("end %s: %v", method, err))
+		}
+	}
+	store := &database.DBStore{DB: db, Hooks: []database.QueryHook{hook}}
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET revoked_at = now()")).WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = store.RevokeSession(context.Background(), 4)
+
+	assert.ErrorIs(t, err, database.ErrNotFound)
+	assert.Equal(t, []string{"begin RevokeSession", "end RevokeSession: session 4 not found"}, calls)
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SQL condition true when no blocker of the task in the tasks table is open
+const notBlocked = `NOT EXISTS (SELECT 1 FROM task_dependencies JOIN tasks AS blockers ON blockers.id = task_dependencies.blocker_id
+	WHERE task_dependencies.task_id = tasks.id AND NOT blockers.state)`
+
+// ErrDependencyCycle is returned when a dependency would make a task block
+// itself
+var ErrDependencyCycle = newError(ErrValidation, "a task cannot block itself or one of its blockers")
+
+// Dependency tells that the task BlockerID blocks the task TaskID
+type Dependency struct {
+	BlockerID int64 `db:"blocker_id"`
+	TaskID    int64 `db:"task_id"`
+}
+
+// DependencyGraph is the set of the tasks blocking a task, directly or not,
+// and of the tasks it blocks, with the dependencies between them
+type DependencyGraph struct {
+	// The task first, then the others sorted by ID
+	Tasks        []*Task
+	Dependencies []Dependency
+}
+
+// checkBlockers tells why a statement completing a task changed nothing :
+// it returns an ErrConflict error if the task has open blockers, and nil
+// otherwise
+func (store *DBStore) checkBlockers(ctx context.Context, userID int64, taskID int) error {
+	rows, err := store.DB.QueryContext(ctx, `SELECT blockers.id FROM task_dependencies
+		JOIN tasks AS blockers ON blockers.id = task_dependencies.blocker_id
+		WHERE task_dependencies.task_id = $1 AND blockers.user_id = $2 AND NOT blockers.state ORDER BY blockers.id`, taskID, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, fmt.Sprint(id))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return newError(ErrConflict, "task %d is blocked by open tasks %s", taskID, strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// AddTaskDependency makes the task blockerID block the task taskID. It
+// returns ErrDependencyCycle if taskID already blocks blockerID, directly or
+// not, and does nothing if the dependency already exists.
+func (store *DBStore) AddTaskDependency(ctx context.Context, userID int64, blockerID, taskID int) (err error) {
+	ctx, end := store.begin(ctx, "AddTaskDependency")
+	defer func() { end(err) }()
+
+	if blockerID == taskID {
+		return ErrDependencyCycle
+	}
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Dependencies of a user are changed one at a time, so that two
+	// concurrent changes cannot create a cycle together
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", userID); err != nil {
+		return err
+	}
+	var found int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE id = ANY($1) AND user_id = $2",
+		pq.Array([]int{blockerID, taskID}), userID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return newError(ErrNotFound, "task %d or %d not found", blockerID, taskID)
+	}
+
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `WITH RECURSIVE blocked AS (
+			SELECT task_id FROM task_dependencies WHERE blocker_id = $1
+			UNION
+			SELECT task_dependencies.task_id FROM task_dependencies JOIN blocked ON task_dependencies.blocker_id = blocked.task_id
+		) SELECT EXISTS (SELECT 1 FROM blocked WHERE task_id = $2)`, taskID, blockerID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO task_dependencies (blocker_id,task_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		blockerID, taskID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveTaskDependency removes the dependency of the task taskID on the task
+// blockerID, or returns ErrNotFound if it does not exist
+func (store *DBStore) RemoveTaskDependency(ctx context.Context, userID int64, blockerID, taskID int) (err error) {
+	ctx, end := store.begin(ctx, "RemoveTaskDependency")
+	defer func() { end(err) }()
+
+	result, err := store.DB.ExecContext(ctx, `DELETE FROM task_dependencies USING tasks
+		WHERE blocker_id = $1 AND task_id = $2 AND tasks.id = task_id AND tasks.user_id = $3`, blockerID, taskID, userID)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return newError(ErrNotFound, "task %d is not blocked by task %d", taskID, blockerID)
+	}
+	return nil
+}
+
+// GetDependencyGraph returns the dependency graph of a task, or ErrNotFound
+// if it does not exist
+func (store *DBStore) GetDependencyGraph(ctx context.Context, userID int64, taskID int) (graph *DependencyGraph, err error) {
+	ctx, end := store.begin(ctx, "GetDependencyGraph")
+	defer func() { end(err) }()
+
+	task, err := scanTask(store.DB.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 AND user_id = $2", taskID, userID))
+	if err != nil {
+		return nil, notFound(err, "task %d not found", taskID)
+	}
+	graph = &DependencyGraph{Tasks: []*Task{task}, Dependencies: []Dependency{}}
+
+	// Dependencies only link tasks of the same user, UNION stops at cycles
+	rows, err := store.DB.QueryContext(ctx, `WITH RECURSIVE blockers AS (
+			SELECT blocker_id, task_id FROM task_dependencies WHERE task_id = $1
+			UNION
+			SELECT task_dependencies.blocker_id, task_dependencies.task_id FROM task_dependencies
+			JOIN blockers ON task_dependencies.task_id = blockers.blocker_id
+		), blocked AS (
+			SELECT blocker_id, task_id FROM task_dependencies WHERE blocker_id = $1
+			UNION
+			SELECT task_dependencies.blocker_id, task_dependencies.task_id FROM task_dependencies
+			JOIN blocked ON task_dependencies.blocker_id = blocked.task_id
+		) SELECT blocker_id, task_id FROM blockers UNION SELECT blocker_id, task_id FROM blocked ORDER BY blocker_id, task_id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	seen := map[int64]bool{task.ID: true}
+	for rows.Next() {
+		var d Dependency
+		if err := rows.Scan(&d.BlockerID, &d.TaskID); err != nil {
+			return nil, err
+		}
+		graph.Dependencies = append(graph.Dependencies, d)
+		for _, id := range []int64{d.BlockerID, d.TaskID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return graph, nil
+	}
+
+	rows, err = store.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = ANY($1) AND user_id = $2 ORDER BY id",
+		pq.Array(ids), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		graph.Tasks = append(graph.Tasks, t)
+	}
+	return graph, rows.Err()
+}
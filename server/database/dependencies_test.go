@@ -0,0 +1,156 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddTaskDependency(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE id = ANY($1) AND user_id = $2")).WithArgs("{3,12}", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("WITH RECURSIVE blocked").WithArgs(12, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO task_dependencies (blocker_id,task_id) VALUES ($1, $2) ON CONFLICT DO NOTHING")).
+		WithArgs(3, 12).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.AddTaskDependency(context.Background(), 7, 3, 12); err != nil {
+		t.Fatalf("Error while adding dependency : %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestAddTaskDependencyCycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	// Task 12 already blocks task 3, directly or not
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).WithArgs("{3,12}", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("WITH RECURSIVE blocked").WithArgs(12, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	err = store.AddTaskDependency(context.Background(), 7, 3, 12)
+	assert.Equal(t, database.ErrDependencyCycle, err)
+
+	// A task cannot block itself
+	err = store.AddTaskDependency(context.Background(), 7, 12, 12)
+	assert.True(t, errors.Is(err, database.ErrValidation))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestAddTaskDependencyNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).WithArgs("{3,12}", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err = store.AddTaskDependency(context.Background(), 7, 3, 12)
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+}
+
+func TestRemoveTaskDependencyNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM task_dependencies USING tasks")).WithArgs(3, 12, 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = store.RemoveTaskDependency(context.Background(), 7, 3, 12)
+	assert.EqualError(t, err, "task 12 is not blocked by task 3")
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+}
+
+func TestSetTaskStateBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET state = $1")).WithArgs(true, 12, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns))
+	mock.ExpectRollback()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT blockers.id FROM task_dependencies")).WithArgs(12, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(5))
+
+	_, err = store.SetTaskState(context.Background(), 7, 12, 0, true)
+	assert.EqualError(t, err, "task 12 is blocked by open tasks 3, 5")
+	assert.True(t, errors.Is(err, database.ErrConflict))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestGetDependencyGraph(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+selectedTaskColumns+" FROM tasks WHERE id = $1 AND user_id = $2")).WithArgs(12, 7).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(12, "Deploy", false)...))
+	// Task 3 blocks task 12, which blocks task 20
+	mock.ExpectQuery("WITH RECURSIVE blockers").WithArgs(12).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id", "task_id"}).AddRow(3, 12).AddRow(12, 20))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+selectedTaskColumns+" FROM tasks WHERE id = ANY($1) AND user_id = $2 ORDER BY id")).
+		WithArgs("{3,20}", 7).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(3, "Review", true)...).AddRow(taskValues(20, "Announce", false)...))
+
+	graph, err := store.GetDependencyGraph(context.Background(), 7, 12)
+	if err != nil {
+		t.Fatalf("Error while loading dependency graph : %s", err)
+	}
+	assert.Len(t, graph.Tasks, 3)
+	assert.Equal(t, int64(12), graph.Tasks[0].ID)
+	assert.Equal(t, []database.Dependency{{BlockerID: 3, TaskID: 12}, {BlockerID: 12, TaskID: 20}}, graph.Dependencies)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
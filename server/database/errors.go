@@ -0,0 +1,55 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Kinds of the errors returned by the methods of Database. Errors of the
+// package wrap one of them, so that callers can check it with errors.Is.
+var (
+	// The row does not exist, or belongs to another user
+	ErrNotFound = errors.New("not found")
+	// The request conflicts with the current state of the data
+	ErrConflict = errors.New("conflict")
+	// A value given to the method is not valid
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is an error of one of the kinds above, with a message which can be
+// shown to the client
+type Error struct {
+	Kind    error
+	Message string
+	// Field of the request body the error is about, "" if none
+	Field string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// fieldError returns an ErrValidation error about a field of the request body
+func fieldError(field, format string, args ...interface{}) *Error {
+	e := newError(ErrValidation, format, args...)
+	e.Field = field
+	return e
+}
+
+// notFound turns sql.ErrNoRows into an ErrNotFound error described by
+// format, and returns the other errors as is
+func notFound(err error, format string, args ...interface{}) error {
+	if err == sql.ErrNoRows {
+		return newError(ErrNotFound, format, args...)
+	}
+	return err
+}
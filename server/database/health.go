@@ -0,0 +1,28 @@
+package database
+
+import "context"
+
+// Ping checks that the database can be reached
+func (store *DBStore) Ping(ctx context.Context) (err error) {
+	ctx, end := store.begin(ctx, "Ping")
+	defer func() { end(err) }()
+
+	return store.DB.PingContext(ctx)
+}
+
+// SchemaVersion returns the current version of the schema and the latest
+// version known by the embedded migrations
+func (store *DBStore) SchemaVersion(ctx context.Context) (current, latest int, err error) {
+	ctx, end := store.begin(ctx, "SchemaVersion")
+	defer func() { end(err) }()
+
+	migrator, err := NewMigrator(store.DB)
+	if err != nil {
+		return 0, 0, err
+	}
+	current, err = migrator.VersionContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return current, migrator.Latest(), nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrListNameTaken = newError(ErrConflict, "list name already taken")
+
+// Postgres error code for foreign key violations
+const foreignKeyViolation = "23503"
+
+// List groups tasks of a user
+type List struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// Number of tasks in the list by state, not stored
+	OpenTasks int64 `db:"-"`
+	DoneTasks int64 `db:"-"`
+}
+
+// Columns read by scanList, in order. They can be returned by any statement
+// on the lists table.
+const listColumns = "id, user_id, name, created_at, updated_at, " +
+	"(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND NOT tasks.state), " +
+	"(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND tasks.state)"
+
+func scanList(row scanner) (*List, error) {
+	var l List
+	if err := row.Scan(&l.ID, &l.UserID, &l.Name, &l.CreatedAt, &l.UpdatedAt, &l.OpenTasks, &l.DoneTasks); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// listError turns the violations of the constraints of lists into errors of
+// the package, and returns the other errors as is
+func listError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrListNameTaken
+	}
+	return err
+}
+
+// taskListError turns the violation of the foreign key of a task to its
+// list into an ErrValidation error, the list being missing or owned by
+// another user
+func taskListError(err error, listID *int64) error {
+	var pqErr *pq.Error
+	if listID != nil && errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation && pqErr.Constraint != parentConstraint {
+		return fieldError("list_id", "list %d not found", *listID)
+	}
+	return err
+}
+
+// CreateList inserts l and sets its ID and timestamps
+func (store *DBStore) CreateList(ctx context.Context, l *List) (id int64, err error) {
+	ctx, end := store.begin(ctx, "CreateList")
+	defer func() { end(err) }()
+
+	list, err := scanList(store.DB.QueryRowContext(ctx, "INSERT INTO lists (user_id,name) VALUES ($1, $2) RETURNING "+listColumns,
+		l.UserID, l.Name))
+	if err != nil {
+		return 0, listError(err)
+	}
+	*l = *list
+	return l.ID, nil
+}
+
+// GetLists returns the lists of a user with their task counts
+func (store *DBStore) GetLists(ctx context.Context, userID int64) (lists []*List, err error) {
+	ctx, end := store.begin(ctx, "GetLists")
+	defer func() { end(err) }()
+
+	rows, err := store.DB.QueryContext(ctx, "SELECT "+listColumns+" FROM lists WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists = []*List{}
+	for rows.Next() {
+		l, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (store *DBStore) GetList(ctx context.Context, userID int64, id int) (list *List, err error) {
+	ctx, end := store.begin(ctx, "GetList")
+	defer func() { end(err) }()
+
+	row := store.DB.QueryRowContext(ctx, "SELECT "+listColumns+" FROM lists WHERE id = $1 AND user_id = $2", id, userID)
+	list, err = scanList(row)
+	return list, notFound(err, "list %d not found", id)
+}
+
+// EditList renames the list l.ID owned by l.UserID, and sets the other
+// fields of l to the updated list
+func (store *DBStore) EditList(ctx context.Context, l *List) (err error) {
+	ctx, end := store.begin(ctx, "EditList")
+	defer func() { end(err) }()
+
+	list, err := scanList(store.DB.QueryRowContext(ctx, "UPDATE lists SET name = $1, updated_at = now() WHERE id = $2 AND user_id = $3 RETURNING "+listColumns,
+		l.Name, l.ID, l.UserID))
+	if err != nil {
+		return notFound(listError(err), "list %d not found", l.ID)
+	}
+	*l = *list
+	return nil
+}
+
+// DeleteList deletes a list and its tasks
+func (store *DBStore) DeleteList(ctx context.Context, userID int64, listID int) (err error) {
+	ctx, end := store.begin(ctx, "DeleteList")
+	defer func() { end(err) }()
+
+	result, err := store.DB.ExecContext(ctx, "DELETE FROM lists WHERE id = $1 AND user_id = $2", listID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return newError(ErrNotFound, "list %d not found", listID)
+	}
+	return nil
+}
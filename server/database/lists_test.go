@@ -0,0 +1,125 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var listColumns = []string{"id", "user_id", "name", "created_at", "updated_at", "open_tasks", "done_tasks"}
+
+const listCounts = "(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND NOT tasks.state), " +
+	"(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND tasks.state)"
+
+func TestGetLists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	query := "SELECT id, user_id, name, created_at, updated_at, " + listCounts + " FROM lists WHERE user_id = $1 ORDER BY id"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(listColumns).
+			AddRow(1, 7, "Sprint", testTime, testTime, 3, 2).
+			AddRow(2, 7, "Backlog", testTime, testTime, 0, 0))
+
+	lists, err := store.GetLists(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Error while getting lists : %s", err)
+	}
+	expected := []*database.List{
+		{ID: 1, UserID: 7, Name: "Sprint", CreatedAt: testTime, UpdatedAt: testTime, OpenTasks: 3, DoneTasks: 2},
+		{ID: 2, UserID: 7, Name: "Backlog", CreatedAt: testTime, UpdatedAt: testTime},
+	}
+	assert.Equal(t, expected, lists)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestCreateListNameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO lists (user_id,name) VALUES ($1, $2) RETURNING id, user_id, name")).
+		WithArgs(7, "Sprint").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	_, err = store.CreateList(context.Background(), &database.List{UserID: 7, Name: "Sprint"})
+	assert.Equal(t, database.ErrListNameTaken, err)
+	assert.True(t, errors.Is(err, database.ErrConflict))
+}
+
+func TestEditListNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE lists SET name = $1, updated_at = now() WHERE id = $2 AND user_id = $3")).
+		WithArgs("Sprint", 4, 7).
+		WillReturnRows(sqlmock.NewRows(listColumns))
+
+	err = store.EditList(context.Background(), &database.List{ID: 4, UserID: 7, Name: "Sprint"})
+	assert.EqualError(t, err, "list 4 not found")
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+}
+
+func TestCreateTaskUnknownList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	listID := int64(3)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tasks (user_id,list_id,content")).
+		WithArgs(7, listID, "Task", "", false, database.PriorityNone, nil, nil, false, "").
+		WillReturnError(&pq.Error{Code: "23503"})
+
+	_, err = store.CreateTask(context.Background(), &database.Task{UserID: 7, ListID: &listID, Content: "Task"})
+	assert.EqualError(t, err, "list 3 not found")
+	assert.True(t, errors.Is(err, database.ErrValidation))
+}
+
+func TestUpdateTaskMoveToList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	listID := int64(3)
+	values := taskChangeValues(12, "Task 1", false, false)
+	values[2] = listID
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET updated_at = now(), version = version + 1, list_id = $1 WHERE id = $2 AND user_id = $3")).
+		WithArgs(listID, 12, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(values...))
+
+	task, err := store.UpdateTask(context.Background(), 7, 12, database.TaskPatch{SetListID: true, ListID: &listID})
+	if err != nil {
+		t.Fatalf("Error while updating task : %v", err)
+	}
+	assert.Equal(t, &listID, task.ListID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
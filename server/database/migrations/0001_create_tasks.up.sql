@@ -1,6 +1,6 @@
---Create Tasks table
+-- Tasks table, previously created by db/init.sql
 CREATE TABLE IF NOT EXISTS tasks(
     id SERIAL PRIMARY KEY,
     content TEXT,
     state BOOLEAN NOT NULL DEFAULT FALSE
-);
\ No newline at end of file
+);
@@ -0,0 +1,12 @@
+-- Users and task ownership
+CREATE TABLE users(
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Tasks created before accounts existed have no owner, until the first user
+-- registered gets them (see CreateUser)
+ALTER TABLE tasks ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX tasks_user_id_idx ON tasks(user_id);
@@ -0,0 +1,12 @@
+-- Login sessions, tokens are only stored as SHA-256 hashes
+CREATE TABLE sessions(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access_token_hash TEXT NOT NULL UNIQUE,
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    refresh_expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
@@ -0,0 +1,7 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS priority,
+    DROP COLUMN IF EXISTS due_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS completed_at;
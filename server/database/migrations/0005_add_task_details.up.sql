@@ -0,0 +1,10 @@
+-- Description, priority, due date and timestamps on tasks
+ALTER TABLE tasks
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN priority SMALLINT NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 3),
+    ADD COLUMN due_at TIMESTAMPTZ,
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN completed_at TIMESTAMPTZ;
+
+UPDATE tasks SET completed_at = now() WHERE state;
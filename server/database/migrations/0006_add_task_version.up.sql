@@ -0,0 +1,2 @@
+-- Version of tasks, incremented by every update, for optimistic concurrency control
+ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
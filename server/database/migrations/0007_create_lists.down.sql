@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS list_id;
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,16 @@
+-- Lists grouping the tasks of a user
+CREATE TABLE lists(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name),
+    -- Referenced by tasks, so that a task can only be in a list of its owner
+    UNIQUE (id, user_id)
+);
+
+-- Tasks without list stay outside of any list, deleting a list deletes its tasks
+ALTER TABLE tasks ADD COLUMN list_id INTEGER,
+    ADD FOREIGN KEY (list_id, user_id) REFERENCES lists(id, user_id) ON DELETE CASCADE;
+CREATE INDEX tasks_list_id_idx ON tasks(list_id);
@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS parent_id,
+    DROP COLUMN IF EXISTS auto_complete;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_id_user_id_key;
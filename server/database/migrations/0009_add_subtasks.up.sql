@@ -0,0 +1,7 @@
+-- Subtasks : a task can have a parent task of the same user. Deleting a task
+-- deletes its subtasks, unless they are moved to its parent first.
+ALTER TABLE tasks ADD UNIQUE (id, user_id);
+ALTER TABLE tasks ADD COLUMN parent_id INTEGER,
+    ADD COLUMN auto_complete BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD FOREIGN KEY (parent_id, user_id) REFERENCES tasks(id, user_id) ON DELETE CASCADE;
+CREATE INDEX tasks_parent_id_idx ON tasks(parent_id);
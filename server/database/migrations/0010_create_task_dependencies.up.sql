@@ -0,0 +1,10 @@
+-- Dependencies between the tasks of a user : a task cannot be completed
+-- while one of its blockers is open
+CREATE TABLE task_dependencies(
+    blocker_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (blocker_id, task_id),
+    CHECK (blocker_id <> task_id)
+);
+CREATE INDEX task_dependencies_task_id_idx ON task_dependencies(task_id);
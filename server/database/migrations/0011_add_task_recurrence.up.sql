@@ -0,0 +1,3 @@
+-- Recurrence rule of recurring tasks, moved to the next occurrence when the
+-- task is completed
+ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
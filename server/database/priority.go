@@ -0,0 +1,35 @@
+package database
+
+import "fmt"
+
+// Priority of a task, stored as a small integer so that tasks can be sorted by it
+type Priority int16
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityNames = []string{"none", "low", "medium", "high"}
+
+func (p Priority) String() string {
+	if p < PriorityNone || p > PriorityHigh {
+		return fmt.Sprintf("Priority(%d)", int16(p))
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority returns the priority named s, "" being PriorityNone
+func ParsePriority(s string) (Priority, error) {
+	if s == "" {
+		return PriorityNone, nil
+	}
+	for i, name := range priorityNames {
+		if s == name {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNone, newError(ErrValidation, "unknown priority %q", s)
+}
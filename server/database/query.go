@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTaskLimit = 100
+	MaxTaskLimit     = 500
+)
+
+var ErrInvalidCursor = newError(ErrValidation, "invalid pagination cursor")
+
+// TaskQuery filters, sorts and paginates a task list
+type TaskQuery struct {
+	// Only tasks of this list, tasks of any list or none if nil
+	ListID *int64
+	// Only subtasks of this task if not nil, or only top level tasks if
+	// TopLevel is true
+	ParentID *int64
+	TopLevel bool
+	// Only tasks with this state, any state if nil
+	State *bool
+	// Case insensitive text searched in content and description
+	Search string
+	// Only tasks with all these tags, or any of them if AnyTag is true
+	Tags   []string
+	AnyTag bool
+	// One of TaskSortFields, "id" if empty
+	Sort string
+	Desc bool
+	// Page size, DefaultTaskLimit if 0
+	Limit int
+	// NextCursor of the previous page, "" for the first page
+	Cursor string
+}
+
+// TaskPage is one page of a task list
+type TaskPage struct {
+	Tasks []*Task
+	// Number of tasks matching the filters, on every page
+	Total int64
+	// Cursor of the next page, "" on the last page
+	NextCursor string
+}
+
+type sortField struct {
+	// SQL expression sorted on, NULL values must be mapped to a real value
+	// so that they can be compared to the cursor
+	expr string
+	// SQL type of the cursor value
+	cast string
+	// Value of a task for this field, as stored in the cursor
+	value func(t *Task) string
+}
+
+var taskSortFields = map[string]sortField{
+	"id": {"id", "bigint", func(t *Task) string {
+		return strconv.FormatInt(t.ID, 10)
+	}},
+	"content": {"content", "text", func(t *Task) string {
+		return t.Content
+	}},
+	"priority": {"priority", "smallint", func(t *Task) string {
+		return strconv.Itoa(int(t.Priority))
+	}},
+	"created_at": {"created_at", "timestamptz", func(t *Task) string {
+		return t.CreatedAt.Format(time.RFC3339Nano)
+	}},
+	"updated_at": {"updated_at", "timestamptz", func(t *Task) string {
+		return t.UpdatedAt.Format(time.RFC3339Nano)
+	}},
+	// Tasks without due date come last
+	"due_at": {"COALESCE(due_at, 'infinity')", "timestamptz", func(t *Task) string {
+		if t.DueAt == nil {
+			return "infinity"
+		}
+		return t.DueAt.Format(time.RFC3339Nano)
+	}},
+}
+
+// validValue reports whether v, taken from a cursor, can be cast to the SQL
+// type of the field
+func (f sortField) validValue(v string) bool {
+	switch f.cast {
+	case "bigint":
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	case "smallint":
+		_, err := strconv.ParseInt(v, 10, 16)
+		return err == nil
+	case "timestamptz":
+		if v == "infinity" {
+			return true
+		}
+		_, err := time.Parse(time.RFC3339Nano, v)
+		return err == nil
+	}
+	return true
+}
+
+// TaskSortFields returns the names accepted in TaskQuery.Sort
+func TaskSortFields() []string {
+	return []string{"id", "content", "priority", "created_at", "updated_at", "due_at"}
+}
+
+// Content of a pagination cursor, base64 encoded JSON
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func (q TaskQuery) sortKey() string {
+	if q.Desc {
+		return q.Sort + " desc"
+	}
+	return q.Sort + " asc"
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (store *DBStore) GetTaskList(ctx context.Context, userID int64, q TaskQuery) (page *TaskPage, err error) {
+	ctx, end := store.begin(ctx, "GetTaskList")
+	defer func() { end(err) }()
+
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	field, ok := taskSortFields[q.Sort]
+	if !ok {
+		return nil, newError(ErrValidation, "unknown sort field %q", q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultTaskLimit
+	}
+	if q.Limit > MaxTaskLimit {
+		q.Limit = MaxTaskLimit
+	}
+
+	// Filters
+	where := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	if q.ListID != nil {
+		args = append(args, *q.ListID)
+		where = append(where, fmt.Sprintf("list_id = $%d", len(args)))
+	}
+	if q.ParentID != nil {
+		args = append(args, *q.ParentID)
+		where = append(where, fmt.Sprintf("parent_id = $%d", len(args)))
+	} else if q.TopLevel {
+		where = append(where, "parent_id IS NULL")
+	}
+	if q.State != nil {
+		args = append(args, *q.State)
+		where = append(where, fmt.Sprintf("state = $%d", len(args)))
+	}
+	if q.Search != "" {
+		args = append(args, "%"+escapeLike(q.Search)+"%")
+		where = append(where, fmt.Sprintf("(content ILIKE $%d OR description ILIKE $%d)", len(args), len(args)))
+	}
+	if len(q.Tags) > 0 {
+		filter, tagArgs := tagFilter(q.Tags, q.AnyTag, len(args)+1)
+		args = append(args, tagArgs...)
+		where = append(where, filter)
+	}
+
+	var total int64
+	err = store.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE "+strings.Join(where, " AND "), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keyset pagination : rows after the last one of the previous page,
+	// ties on the sort field being broken by id
+	direction, compare := "ASC", ">"
+	if q.Desc {
+		direction, compare = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != q.sortKey() || !field.validValue(c.Value) {
+			return nil, ErrInvalidCursor
+		}
+		if field.expr == "id" {
+			args = append(args, c.ID)
+			where = append(where, fmt.Sprintf("id %s $%d", compare, len(args)))
+		} else {
+			args = append(args, c.Value, c.ID)
+			where = append(where, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", field.expr, compare, len(args)-1, field.cast, len(args)))
+		}
+	}
+	order := fmt.Sprintf("%s %s", field.expr, direction)
+	if field.expr != "id" {
+		order += fmt.Sprintf(", id %s", direction)
+	}
+
+	// One more row than needed tells if there is a next page
+	query := fmt.Sprintf("SELECT %s FROM tasks WHERE %s ORDER BY %s LIMIT %d",
+		taskColumns, strings.Join(where, " AND "), order, q.Limit+1)
+	rows, err := store.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page = &TaskPage{Tasks: []*Task{}, Total: total}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Tasks = append(page.Tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Tasks) > q.Limit {
+		page.Tasks = page.Tasks[:q.Limit]
+		last := page.Tasks[q.Limit-1]
+		page.NextCursor = encodeCursor(cursor{Sort: q.sortKey(), Value: field.value(last), ID: last.ID})
+	}
+	return page, nil
+}
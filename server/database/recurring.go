@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Thybaau/todolist-app/recurrence"
+)
+
+// querier runs queries on the database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// changeTaskState runs a statement changing the state of a task and
+// returning taskChangeColumns. When it may complete the task, it runs in a
+// transaction with the consequences of the completion : the next occurrence
+// of a recurring task is created and the parents of the task auto complete.
+// When before is not nil, it runs first in the same transaction.
+func (store *DBStore) changeTaskState(ctx context.Context, completing bool, before func(q querier) error, query string, args ...interface{}) (*Task, error) {
+	if !completing && before == nil {
+		return scanTaskChange(store.DB.QueryRowContext(ctx, query, args...))
+	}
+
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if before != nil {
+		if err := before(tx); err != nil {
+			return nil, err
+		}
+	}
+	task, err := scanTaskChange(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return nil, err
+	}
+	if task.JustCompleted {
+		created, err := createNextOccurrence(ctx, tx, task)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			task.CreatedOccurrences++
+		}
+		if err := completeParents(ctx, tx, task); err != nil {
+			return nil, err
+		}
+	}
+	return task, tx.Commit()
+}
+
+// createNextOccurrence creates the next occurrence of a recurring task which
+// was just completed, due at the next date of its rule after its due date,
+// or after its completion if it has none. The rule moves to the next
+// occurrence, so that reopening and completing the task again does not
+// create another one. It reports whether an occurrence was created.
+func createNextOccurrence(ctx context.Context, q querier, t *Task) (bool, error) {
+	if t.Recurrence == "" {
+		return false, nil
+	}
+	rule, err := recurrence.Parse(t.Recurrence)
+	if err != nil {
+		return false, err
+	}
+	if _, err := q.ExecContext(ctx, "UPDATE tasks SET recurrence = '' WHERE id = $1", t.ID); err != nil {
+		return false, err
+	}
+	t.Recurrence = ""
+
+	from := time.Now()
+	if t.DueAt != nil {
+		from = *t.DueAt
+	} else if t.CompletedAt != nil {
+		from = *t.CompletedAt
+	}
+	dueAt, rest, ok := rule.Next(from)
+	if !ok {
+		return false, nil
+	}
+	next := &Task{
+		UserID:       t.UserID,
+		ListID:       t.ListID,
+		ParentID:     t.ParentID,
+		Content:      t.Content,
+		Description:  t.Description,
+		Priority:     t.Priority,
+		DueAt:        &dueAt,
+		AutoComplete: t.AutoComplete,
+		Recurrence:   rest.String(),
+	}
+	if err := insertTask(ctx, q, next); err != nil {
+		return false, err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO task_tags (task_id,tag_id) SELECT $1, tag_id FROM task_tags WHERE task_id = $2",
+		next.ID, t.ID)
+	return err == nil, err
+}
@@ -0,0 +1,77 @@
+package database_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/stretchr/testify/assert"
+)
+
+const insertTask = "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
+
+func TestSetTaskStateCreatesNextOccurrence(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	// Due on the last Friday of March, completed on time
+	dueAt := time.Date(2024, 3, 29, 17, 0, 0, 0, time.UTC)
+	values := taskChangeValues(12, "Send invoices", true, true)
+	values[6], values[7], values[17] = database.PriorityHigh, dueAt, "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET state = $1")).WithArgs(true, 12, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(values...))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks SET recurrence = '' WHERE id = $1")).WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(insertTask)).
+		WithArgs(7, nil, "Send invoices", "", false, database.PriorityHigh, time.Date(2024, 4, 26, 17, 0, 0, 0, time.UTC), nil, false,
+			"FREQ=MONTHLY;BYDAY=-1FR;COUNT=2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(13, testTime, testTime, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO task_tags (task_id,tag_id) SELECT $1, tag_id FROM task_tags WHERE task_id = $2")).
+		WithArgs(13, 12).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	task, err := store.SetTaskState(context.Background(), 7, 12, 0, true)
+	if err != nil {
+		t.Fatalf("Error while setting task state : %s", err)
+	}
+	assert.Equal(t, "", task.Recurrence)
+	assert.Equal(t, 1, task.CreatedOccurrences)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestSetTaskStateLastOccurrence(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	values := taskChangeValues(12, "Water plants", true, true)
+	values[17] = "FREQ=DAILY;COUNT=1"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET state = $1")).WithArgs(true, 12, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(values...))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks SET recurrence = '' WHERE id = $1")).WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := store.SetTaskState(context.Background(), 7, 12, 0, true); err != nil {
+		t.Fatalf("Error while setting task state : %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
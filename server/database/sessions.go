@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a login session, identified by an access token and renewed with a refresh token
+type Session struct {
+	ID               int64      `db:"id"`
+	UserID           int64      `db:"user_id"`
+	AccessTokenHash  string     `db:"access_token_hash"`
+	AccessExpiresAt  time.Time  `db:"access_expires_at"`
+	RefreshTokenHash string     `db:"refresh_token_hash"`
+	RefreshExpiresAt time.Time  `db:"refresh_expires_at"`
+	CreatedAt        time.Time  `db:"created_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+func (store *DBStore) CreateSession(ctx context.Context, s *Session) (id int64, err error) {
+	ctx, end := store.begin(ctx, "CreateSession")
+	defer func() { end(err) }()
+
+	err = store.DB.QueryRowContext(ctx, `INSERT INTO sessions (user_id,access_token_hash,access_expires_at,refresh_token_hash,refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		s.UserID, s.AccessTokenHash, s.AccessExpiresAt, s.RefreshTokenHash, s.RefreshExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetSessionByAccessToken returns the session of a valid access token,
+// ErrNotFound if the token is unknown, expired or revoked
+func (store *DBStore) GetSessionByAccessToken(ctx context.Context, hash string) (session *Session, err error) {
+	ctx, end := store.begin(ctx, "GetSessionByAccessToken")
+	defer func() { end(err) }()
+
+	row := store.DB.QueryRowContext(ctx, `SELECT id, user_id, access_expires_at, refresh_expires_at FROM sessions
+		WHERE access_token_hash = $1 AND revoked_at IS NULL AND access_expires_at > now()`, hash)
+
+	s := Session{AccessTokenHash: hash}
+	if err := row.Scan(&s.ID, &s.UserID, &s.AccessExpiresAt, &s.RefreshExpiresAt); err != nil {
+		return nil, notFound(err, "session not found")
+	}
+	return &s, nil
+}
+
+// RefreshSession replaces both tokens of the session owning a valid refresh
+// token. The old refresh token cannot be used again. It returns ErrNotFound
+// if the refresh token is unknown, expired or revoked.
+func (store *DBStore) RefreshSession(ctx context.Context, oldRefreshHash string, s *Session) (err error) {
+	ctx, end := store.begin(ctx, "RefreshSession")
+	defer func() { end(err) }()
+
+	row := store.DB.QueryRowContext(ctx, `UPDATE sessions
+		SET access_token_hash = $1, access_expires_at = $2, refresh_token_hash = $3, refresh_expires_at = $4
+		WHERE refresh_token_hash = $5 AND revoked_at IS NULL AND refresh_expires_at > now()
+		RETURNING id, user_id`,
+		s.AccessTokenHash, s.AccessExpiresAt, s.RefreshTokenHash, s.RefreshExpiresAt, oldRefreshHash)
+	return notFound(row.Scan(&s.ID, &s.UserID), "session not found")
+}
+
+func (store *DBStore) RevokeSession(ctx context.Context, sessionID int64) (err error) {
+	ctx, end := store.begin(ctx, "RevokeSession")
+	defer func() { end(err) }()
+
+	result, err := store.DB.ExecContext(ctx, "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", sessionID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return newError(ErrNotFound, "session %d not found", sessionID)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Name of the foreign key of a task to its parent
+const parentConstraint = "tasks_parent_id_user_id_fkey"
+
+// SQL expressions of the number of direct subtasks of a task, and of those
+// done, read by scanTask after taskTagsColumn
+const subtaskCountsColumns = "(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id), " +
+	"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.state)"
+
+// ErrParentCycle is returned when moving a task under itself or one of its
+// subtasks
+var ErrParentCycle = fieldError("parent_id", "a task cannot be a subtask of itself or of its subtasks")
+
+// taskParentError turns the violation of the foreign key of a task to its
+// parent into an ErrValidation error, the parent being missing or owned by
+// another user
+func taskParentError(err error, parentID *int64) error {
+	var pqErr *pq.Error
+	if parentID != nil && errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation && pqErr.Constraint == parentConstraint {
+		return fieldError("parent_id", "parent task %d not found", *parentID)
+	}
+	return err
+}
+
+// checkParent returns ErrParentCycle if parentID is taskID or one of its
+// subtasks. It runs in the transaction moving the task, once the tasks of
+// the user are locked, so that two concurrent moves cannot create a cycle
+// together.
+func checkParent(ctx context.Context, q querier, userID int64, taskID int, parentID int64) error {
+	if _, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", userID); err != nil {
+		return err
+	}
+	var cycle bool
+	err := q.QueryRowContext(ctx, `WITH RECURSIVE subtree AS (
+			SELECT id FROM tasks WHERE id = $1
+			UNION
+			SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id
+		) SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`, taskID, parentID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrParentCycle
+	}
+	return nil
+}
+
+// completeParents completes the parents of a task which was just completed,
+// from the closest one, as long as they auto complete, all their subtasks
+// are done and none of their blockers is open. Recurring parents get their
+// next occurrence. Both are counted in t.
+func completeParents(ctx context.Context, q querier, t *Task) error {
+	parentID := t.ParentID
+	for parentID != nil {
+		parent, err := scanTask(q.QueryRowContext(ctx, `UPDATE tasks SET state = TRUE, completed_at = now(), updated_at = now(), version = version + 1
+			WHERE id = $1 AND auto_complete AND NOT state
+			AND NOT EXISTS (SELECT 1 FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND NOT subtasks.state)
+			AND `+notBlocked+` RETURNING `+taskColumns, *parentID))
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.CompletedParents++
+		created, err := createNextOccurrence(ctx, q, parent)
+		if err != nil {
+			return err
+		}
+		if created {
+			t.CreatedOccurrences++
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// GetTaskTree returns a task followed by all its subtasks, nested or not,
+// sorted by depth then ID so that every task comes after its parent
+func (store *DBStore) GetTaskTree(ctx context.Context, userID int64, taskID int) (tasks []*Task, err error) {
+	ctx, end := store.begin(ctx, "GetTaskTree")
+	defer func() { end(err) }()
+
+	rows, err := store.DB.QueryContext(ctx, `WITH RECURSIVE tree AS (
+			SELECT id AS task_id, 0 AS depth FROM tasks WHERE id = $1 AND user_id = $2
+			UNION
+			SELECT tasks.id, tree.depth + 1 FROM tasks JOIN tree ON tasks.parent_id = tree.task_id
+		) SELECT `+taskColumns+` FROM tasks JOIN tree ON tree.task_id = tasks.id ORDER BY tree.depth, tasks.id`, taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks = []*Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, newError(ErrNotFound, "task %d not found", taskID)
+	}
+	return tasks, nil
+}
+
+// deleteTaskPromotingChildren deletes a task after moving its subtasks to
+// its parent, or to the top level if it has none
+func (store *DBStore) deleteTaskPromotingChildren(ctx context.Context, userID int64, taskID int, version int64) error {
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID *int64
+	var current int64
+	err = tx.QueryRowContext(ctx, "SELECT parent_id, version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE", taskID, userID).
+		Scan(&parentID, &current)
+	if err != nil {
+		return notFound(err, "task %d not found", taskID)
+	}
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE tasks SET parent_id = $1, updated_at = now(), version = version + 1 WHERE parent_id = $2",
+		parentID, taskID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", taskID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
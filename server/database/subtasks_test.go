@@ -0,0 +1,183 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const completeParent = "UPDATE tasks SET state = TRUE, completed_at = now(), updated_at = now(), version = version + 1 WHERE id = $1 AND auto_complete"
+
+func TestSetTaskStateCompletesParents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	values := taskChangeValues(12, "Buy eggs", true, true)
+	values[13] = 5
+	parent := taskValues(5, "Groceries", true)
+	parent[13] = 2
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET state = $1")).WithArgs(true, 12, 7, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(values...))
+	// Task 5 auto completes, its parent 2 still has open subtasks
+	mock.ExpectQuery(regexp.QuoteMeta(completeParent)).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(parent...))
+	mock.ExpectQuery(regexp.QuoteMeta(completeParent)).WithArgs(2).WillReturnError(sql.ErrNoRows)
+	mock.ExpectCommit()
+
+	task, err := store.SetTaskState(context.Background(), 7, 12, 0, true)
+	if err != nil {
+		t.Fatalf("Error while setting task state : %s", err)
+	}
+	assert.True(t, task.JustCompleted)
+	assert.Equal(t, 1, task.CompletedParents)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestGetTaskTree(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	root := taskValues(5, "Groceries", false)
+	root[15], root[16] = 2, 1
+	child := taskValues(12, "Buy eggs", true)
+	child[13] = 5
+	query := "SELECT " + selectedTaskColumns + " FROM tasks JOIN tree ON tree.task_id = tasks.id ORDER BY tree.depth, tasks.id"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(5, 7).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(root...).AddRow(child...))
+
+	tasks, err := store.GetTaskTree(context.Background(), 7, 5)
+	if err != nil {
+		t.Fatalf("Error while loading task tree : %s", err)
+	}
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, int64(2), tasks[0].Subtasks)
+	assert.Equal(t, int64(1), tasks[0].DoneSubtasks)
+	assert.Equal(t, int64(5), *tasks[1].ParentID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestGetTaskTreeNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectQuery("WITH RECURSIVE tree").WithArgs(5, 7).WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	_, err = store.GetTaskTree(context.Background(), 7, 5)
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+}
+
+func TestUpdateTaskParentCycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	// The cycle is checked in the transaction moving the task
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("WITH RECURSIVE subtree").WithArgs(5, int64(12)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	parentID := int64(12)
+	_, err = store.UpdateTask(context.Background(), 7, 5, database.TaskPatch{SetParentID: true, ParentID: &parentID})
+	assert.Equal(t, database.ErrParentCycle, err)
+	assert.True(t, errors.Is(err, database.ErrValidation))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestCreateTaskUnknownParent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	listID, parentID := int64(3), int64(12)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tasks (user_id,list_id,content")).
+		WithArgs(7, listID, "Task", "", false, database.PriorityNone, nil, parentID, false, "").
+		WillReturnError(&pq.Error{Code: "23503", Constraint: "tasks_parent_id_user_id_fkey"})
+
+	_, err = store.CreateTask(context.Background(), &database.Task{UserID: 7, ListID: &listID, ParentID: &parentID, Content: "Task"})
+	assert.EqualError(t, err, "parent task 12 not found")
+	assert.True(t, errors.Is(err, database.ErrValidation))
+}
+
+func TestDeleteTaskPromoteChildren(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT parent_id, version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(5, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id", "version"}).AddRow(2, 3))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks SET parent_id = $1, updated_at = now(), version = version + 1 WHERE parent_id = $2")).
+		WithArgs(2, 5).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM tasks WHERE id = $1")).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.DeleteTask(context.Background(), 7, 5, 3, true); err != nil {
+		t.Fatalf("Error while deleting task : %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestDeleteTaskPromoteChildrenVersionMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT parent_id, version FROM tasks")).WithArgs(5, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id", "version"}).AddRow(nil, 4))
+	mock.ExpectRollback()
+
+	err = store.DeleteTask(context.Background(), 7, 5, 3, true)
+	assert.Equal(t, database.ErrVersionMismatch, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
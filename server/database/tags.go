@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Tag labels tasks of a user
+type Tag struct {
+	ID     int64  `db:"id"`
+	UserID int64  `db:"user_id"`
+	Name   string `db:"name"`
+	// Number of tasks with the tag, not stored
+	Tasks int64 `db:"-"`
+}
+
+// SQL expression of the names of the tags of a task, sorted, read by
+// scanTask as the last of taskColumns
+const taskTagsColumn = "ARRAY(SELECT tags.name FROM task_tags JOIN tags ON tags.id = task_tags.tag_id " +
+	"WHERE task_tags.task_id = tasks.id ORDER BY tags.name)"
+
+// tagFilter returns the condition selecting the tasks with all the tags
+// (or any of them if anyTag is true), and its arguments numbered from arg
+func tagFilter(tags []string, anyTag bool, arg int) (string, []interface{}) {
+	unique := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	query := "id IN (SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name = ANY($%d)"
+	if anyTag {
+		return fmt.Sprintf(query+")", arg), []interface{}{pq.Array(unique)}
+	}
+	query += " GROUP BY task_tags.task_id HAVING COUNT(*) = $%d)"
+	return fmt.Sprintf(query, arg, arg+1), []interface{}{pq.Array(unique), len(unique)}
+}
+
+// GetTags returns the tags of a user used by at least one task, sorted by name
+func (store *DBStore) GetTags(ctx context.Context, userID int64) (tags []*Tag, err error) {
+	ctx, end := store.begin(ctx, "GetTags")
+	defer func() { end(err) }()
+
+	rows, err := store.DB.QueryContext(ctx, `SELECT tags.id, tags.user_id, tags.name, COUNT(*) FROM tags
+		JOIN task_tags ON task_tags.tag_id = tags.id
+		WHERE tags.user_id = $1 GROUP BY tags.id ORDER BY tags.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags = []*Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Tasks); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// AddTaskTag tags a task, creating the tag if the user has none with this
+// name, and returns the task. Adding a tag the task already has changes
+// nothing. When version is not 0, the task is only changed if it still has
+// this version, or ErrVersionMismatch is returned.
+func (store *DBStore) AddTaskTag(ctx context.Context, userID int64, taskID int, version int64, tag string) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "AddTaskTag")
+	defer func() { end(err) }()
+
+	return store.changeTaskTags(ctx, userID, taskID, version, func(tx *sql.Tx) (bool, error) {
+		var tagID int64
+		// Updating the conflicting row returns its ID
+		err := tx.QueryRowContext(ctx, `INSERT INTO tags (user_id,name) VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name RETURNING id`, userID, tag).Scan(&tagID)
+		if err != nil {
+			return false, err
+		}
+		result, err := tx.ExecContext(ctx, "INSERT INTO task_tags (task_id,tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", taskID, tagID)
+		if err != nil {
+			return false, err
+		}
+		added, err := result.RowsAffected()
+		return added > 0, err
+	})
+}
+
+// RemoveTaskTag removes a tag from a task and returns the task. Removing a
+// tag the task does not have changes nothing. The version is checked as in
+// AddTaskTag.
+func (store *DBStore) RemoveTaskTag(ctx context.Context, userID int64, taskID int, version int64, tag string) (task *Task, err error) {
+	ctx, end := store.begin(ctx, "RemoveTaskTag")
+	defer func() { end(err) }()
+
+	return store.changeTaskTags(ctx, userID, taskID, version, func(tx *sql.Tx) (bool, error) {
+		result, err := tx.ExecContext(ctx, `DELETE FROM task_tags USING tags
+			WHERE task_tags.tag_id = tags.id AND task_tags.task_id = $1 AND tags.name = $2`, taskID, tag)
+		if err != nil {
+			return false, err
+		}
+		removed, err := result.RowsAffected()
+		return removed > 0, err
+	})
+}
+
+// changeTaskTags runs change in a transaction, once the task is locked and
+// its version checked, and returns the task. Its version is incremented if
+// change reports that it changed the tags of the task.
+func (store *DBStore) changeTaskTags(ctx context.Context, userID int64, taskID int, version int64, change func(tx *sql.Tx) (bool, error)) (*Task, error) {
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE", taskID, userID).Scan(&current)
+	if err != nil {
+		return nil, notFound(err, "task %d not found", taskID)
+	}
+	if version != 0 && current != version {
+		return nil, ErrVersionMismatch
+	}
+	changed, err := change(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + taskColumns + " FROM tasks WHERE id = $1"
+	if changed {
+		query = "UPDATE tasks SET updated_at = now(), version = version + 1 WHERE id = $1 RETURNING " + taskColumns
+	}
+	task, err := scanTask(tx.QueryRowContext(ctx, query, taskID))
+	if err != nil {
+		return nil, err
+	}
+	return task, tx.Commit()
+}
@@ -0,0 +1,138 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddTaskTag(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	values := taskValues(12, "Fix login", false)
+	values[11], values[12] = 2, "{bug,urgent}"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(12, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tags (user_id,name) VALUES ($1, $2)")).WithArgs(7, "bug").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO task_tags (task_id,tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING")).WithArgs(12, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET updated_at = now(), version = version + 1 WHERE id = $1 RETURNING " + selectedTaskColumns)).
+		WithArgs(12).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+	mock.ExpectCommit()
+
+	task, err := store.AddTaskTag(context.Background(), 7, 12, 0, "bug")
+	if err != nil {
+		t.Fatalf("Error while adding tag : %s", err)
+	}
+	assert.Equal(t, []string{"bug", "urgent"}, task.Tags)
+	assert.Equal(t, int64(2), task.Version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestRemoveTaskTagUnchanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(12, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM task_tags USING tags")).WithArgs(12, "bug").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Removing a missing tag keeps the version
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1")).WithArgs(12).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(12, "Fix login", false)...))
+	mock.ExpectCommit()
+
+	task, err := store.RemoveTaskTag(context.Background(), 7, 12, 0, "bug")
+	if err != nil {
+		t.Fatalf("Error while removing tag : %s", err)
+	}
+	assert.Equal(t, []string{}, task.Tags)
+	assert.Equal(t, int64(1), task.Version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestAddTaskTagNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(12, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectRollback()
+
+	_, err = store.AddTaskTag(context.Background(), 7, 12, 0, "bug")
+	assert.EqualError(t, err, "task 12 not found")
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
+
+func TestGetTaskListByTags(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	store := &database.DBStore{DB: db}
+
+	allTags := "id IN (SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name = ANY($2) " +
+		"GROUP BY task_tags.task_id HAVING COUNT(*) = $3)"
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND "+allTags)).
+		WithArgs(7, "{\"bug\",\"home\"}", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM tasks WHERE user_id = $1 AND "+allTags+" ORDER BY id ASC")).
+		WithArgs(7, "{\"bug\",\"home\"}", 2).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	_, err = store.GetTaskList(context.Background(), 7, database.TaskQuery{Tags: []string{"bug", "home", "bug"}})
+	if err != nil {
+		t.Fatalf("Error while executing GetTaskList : %s", err)
+	}
+
+	anyTag := "id IN (SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name = ANY($2))"
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND "+anyTag)).
+		WithArgs(7, "{\"bug\",\"home\"}").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM tasks WHERE user_id = $1 AND "+anyTag+" ORDER BY id ASC")).
+		WithArgs(7, "{\"bug\",\"home\"}").
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	_, err = store.GetTaskList(context.Background(), 7, database.TaskQuery{Tags: []string{"bug", "home"}, AnyTag: true})
+	if err != nil {
+		t.Fatalf("Error while executing GetTaskList : %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
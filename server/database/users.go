@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrUsernameTaken = newError(ErrConflict, "username already taken")
+
+// Postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+type User struct {
+	ID           int64     `db:"id"`
+	Username     string    `db:"username"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+func (store *DBStore) CreateUser(ctx context.Context, u *User) (id int64, err error) {
+	ctx, end := store.begin(ctx, "CreateUser")
+	defer func() { end(err) }()
+
+	// Tasks created before authentication have no owner, the first user
+	// registered gets them. The subquery sees users as before the insert.
+	query := `WITH created AS (
+			INSERT INTO users (username,password_hash) VALUES ($1, $2) RETURNING id
+		), claimed AS (
+			UPDATE tasks SET user_id = (SELECT id FROM created)
+			WHERE user_id IS NULL AND NOT EXISTS (SELECT 1 FROM users)
+		)
+		SELECT id FROM created`
+	err = store.DB.QueryRowContext(ctx, query, u.Username, u.PasswordHash).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, ErrUsernameTaken
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func (store *DBStore) GetUserByUsername(ctx context.Context, username string) (u *User, err error) {
+	ctx, end := store.begin(ctx, "GetUserByUsername")
+	defer func() { end(err) }()
+
+	row := store.DB.QueryRowContext(ctx, "SELECT id, username, password_hash, created_at FROM users WHERE username = $1", username)
+
+	var user User
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt); err != nil {
+		return nil, notFound(err, "user %q not found", username)
+	}
+	return &user, nil
+}
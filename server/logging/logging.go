@@ -0,0 +1,77 @@
+// Package logging configures the structured logger of the server and carries
+// request-scoped loggers in contexts, so that the handlers and the database
+// layer log with the ID of the request they serve.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats of New
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New returns a logger writing to w records of at least level ("debug",
+// "info", "warn" or "error") in format (FormatJSON or FormatText)
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	scopeKey
+)
+
+// scope records the last logger set in the contexts derived from the one of
+// NewScope
+type scope struct {
+	logger *slog.Logger
+}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	if s, ok := ctx.Value(scopeKey).(*scope); ok {
+		s.logger = logger
+	}
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// NewScope returns a copy of ctx, and a function returning the last logger
+// set by NewContext in the contexts derived from it. Middlewares use it to
+// log with the attributes added by the handlers they wrap, such as the trace
+// ID known once the route of a request is matched.
+func NewScope(ctx context.Context) (context.Context, func() *slog.Logger) {
+	s := &scope{logger: FromContext(ctx)}
+	return context.WithValue(ctx, scopeKey, s), func() *slog.Logger {
+		return s.logger
+	}
+}
+
+// FromContext returns the logger of ctx, or the default logger if there is
+// none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,56 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("Cannot create logger : %s", err)
+	}
+	logger.Info("ignored")
+	logger.Warn("kept", "request_id", "abc")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Cannot decode log record %q : %s", buf.String(), err)
+	}
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "abc", record["request_id"])
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := logging.New(&bytes.Buffer{}, "verbose", "json")
+	assert.EqualError(t, err, `unknown log level "verbose"`)
+	_, err = logging.New(&bytes.Buffer{}, "info", "xml")
+	assert.EqualError(t, err, `unknown log format "xml"`)
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "info", "text")
+	ctx := logging.NewContext(context.Background(), logger.With("request_id", "abc"))
+
+	logging.FromContext(ctx).Info("hello")
+	assert.Contains(t, buf.String(), "msg=hello request_id=abc")
+}
+
+func TestNewScope(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "info", "text")
+	ctx, last := logging.NewScope(logging.NewContext(context.Background(), logger))
+
+	// Loggers set below the scope are seen from it
+	logging.NewContext(ctx, logger.With("trace_id", "0af7"))
+	last().Info("served")
+	assert.Contains(t, buf.String(), "msg=served trace_id=0af7")
+}
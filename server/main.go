@@ -1,47 +1,173 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/Thybaau/todolist-app/config"
 	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/logging"
+	"github.com/Thybaau/todolist-app/metrics"
 	"github.com/Thybaau/todolist-app/middleware"
 	"github.com/Thybaau/todolist-app/router"
+	"github.com/Thybaau/todolist-app/tracing"
 	"github.com/gorilla/handlers"
 )
 
-const (
-	host     = "database"
-	port     = 5432
-	user     = "postgres"
-	password = "123456"
-	dbname   = "todolist_db"
-)
-
 func main() {
-	log.Printf("Running todo-list app Golang...")
+	// Optional subcommand, the server is started by default
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "migrate") {
+		command, args = args[0], args[1:]
+	}
+	cfg, err := config.Load(args, os.Getenv)
+	if err != nil {
+		fatal(err)
+	}
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal(err)
+	}
+	slog.SetDefault(logger)
+	slog.Info("Running todo-list app Golang...", "command", command)
+
+	switch command {
+	case "migrate":
+		err = migrate(cfg)
+	default:
+		err = run(cfg)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err and exits
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+func run(cfg *config.Config) error {
+	// Stop on Ctrl+C or when the container is stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	srv := router.NewServer()
+	srv.AccessTokenTTL = time.Duration(cfg.AccessTokenTTL)
+	srv.RefreshTokenTTL = time.Duration(cfg.RefreshTokenTTL)
+
+	m := metrics.New()
+	srv.Metrics = m
+
+	// Tracing, flushed once everything else is stopped
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.SampleRatio, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("Cannot flush traces", "error", err)
+		}
+	}()
 
 	// Database connexion
-	srv.DB = &database.DBStore{}
-	err := srv.DB.Connect(host, port, user, password, dbname)
+	store := &database.DBStore{
+		AutoMigrate:     cfg.DB.AutoMigrate,
+		QueryTimeout:    time.Duration(cfg.DB.QueryTimeout),
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.DB.ConnMaxLifetime),
+		Hooks:           []database.QueryHook{m.QueryHook, tracing.QueryHook},
+	}
+	err = store.Connect(ctx, cfg.DB.Host, cfg.DB.Port, cfg.DB.User, cfg.DB.Password, cfg.DB.Name)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Connected to database")
-	defer srv.DB.Close()
+	srv.DB = store
+	m.WatchDB(store.DB, cfg.DB.Name)
+	slog.Info("Connected to database")
+	// Closed last, once every in-flight request is done with it
+	defer func() {
+		if err := srv.DB.Close(); err != nil {
+			slog.Error("Cannot close database", "error", err)
+		}
+		slog.Info("Database connexion closed")
+	}()
 
 	// Middleware CORS
-	headers := handlers.AllowedHeaders([]string{"Content-Type", "Authorization"})
-	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"})
-	origins := handlers.AllowedOrigins([]string{"http://localhost:3000"})
+	headers := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", middleware.RequestIDHeader, "traceparent", "tracestate"})
+	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	origins := handlers.AllowedOrigins(cfg.CORSOrigins)
+	exposed := handlers.ExposedHeaders([]string{"X-Total-Count", "X-Next-Cursor", "Link", "Deprecation", "ETag", middleware.RequestIDHeader})
 
 	// Server connexion
-	// http.HandleFunc("/", srv.serveHTTP)
-	srv.Router.Use(middleware.LogRequests)
-	log.Printf("Running server on port 9000")
-	err = http.ListenAndServe(":9000", handlers.CORS(headers, methods, origins)(srv.Router))
-	if err != nil {
-		log.Fatal(err)
+	// Requests matching no route are identified, logged and measured too,
+	// mux middlewares only running on matched routes
+	srv.Router.Use(tracing.Middleware)
+	handler := middleware.RequestID(middleware.LogRequests(m.Instrument(srv.Router)))
+	httpServer := &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      handlers.CORS(headers, methods, origins, exposed)(handler),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.IdleTimeout),
+	}
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("Running server", "addr", cfg.ListenAddr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	// Admin server, on its own port to keep metrics private
+	var adminServer *http.Server
+	if cfg.AdminListenAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", m.Handler())
+		adminServer = &http.Server{
+			Addr:         cfg.AdminListenAddr,
+			Handler:      adminMux,
+			ReadTimeout:  time.Duration(cfg.ReadTimeout),
+			WriteTimeout: time.Duration(cfg.WriteTimeout),
+		}
+		go func() {
+			slog.Info("Running admin server", "addr", cfg.AdminListenAddr)
+			if err := adminServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+		stop()
+	}
+
+	// Stop accepting connexions and wait for in-flight requests
+	slog.Info("Shutting down server, waiting for in-flight requests", "timeout", time.Duration(cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Cannot drain every request before deadline", "error", err)
+		httpServer.Close()
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	slog.Info("Server stopped")
+	return nil
 }
@@ -0,0 +1,151 @@
+// Package metrics exposes the Prometheus metrics of the server : HTTP
+// requests by route, database calls by method, the connexion pool and
+// business counters.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prefix of the names of every metric of the server
+const namespace = "todolist"
+
+// Metrics holds the collectors of the server, in their own registry
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dbDuration      *prometheus.HistogramVec
+	tasksCreated    prometheus.Counter
+	tasksCompleted  prometheus.Counter
+}
+
+// New creates the metrics of the server, with the Go runtime and process
+// collectors
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests served, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_call_duration_seconds",
+			Help:      "Duration of database calls, by store method and result.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "result"}),
+		tasksCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_created_total",
+			Help:      "Number of tasks created.",
+		}),
+		tasksCompleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_completed_total",
+			Help:      "Number of tasks marked as done.",
+		}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.dbDuration, m.tasksCreated, m.tasksCompleted,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Instrument measures the requests served by router by the path template of
+// their route, such as /api/v1/tasks/{id}, to keep the number of series low.
+// Requests matching no route, answered with a 404 or a 405, are measured as
+// route "unknown".
+func (m *Metrics) Instrument(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		router.ServeHTTP(sw, r)
+
+		route := "unknown"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(sw.status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// QueryHook measures the calls of a database.DBStore, by method. Calls are
+// "ok", or failed with an "error" of the domain (such as a missing task) or
+// of the "database".
+func (m *Metrics) QueryHook(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		result := "ok"
+		var domainErr *database.Error
+		switch {
+		case errors.As(err, &domainErr):
+			result = "error"
+		case err != nil:
+			result = "database"
+		}
+		m.dbDuration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+	}
+}
+
+// WatchDB exports the connexion pool statistics of db
+func (m *Metrics) WatchDB(db *sql.DB, name string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// TaskCreated counts a created task. Like TaskCompleted, it does nothing on
+// a nil *Metrics, so that handlers can be used without metrics.
+func (m *Metrics) TaskCreated() {
+	if m != nil {
+		m.tasksCreated.Inc()
+	}
+}
+
+// TaskCompleted counts a task marked as done
+func (m *Metrics) TaskCompleted() {
+	if m != nil {
+		m.tasksCompleted.Inc()
+	}
+}
@@ -0,0 +1,83 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentByRouteTemplate(t *testing.T) {
+	m := metrics.New()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "404" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	handler := m.Instrument(r)
+
+	for _, path := range []string{"/api/v1/tasks/1", "/api/v1/tasks/2", "/api/v1/tasks/404", "/api/v1/unknown"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	expected := `
+# HELP todolist_http_requests_total Number of HTTP requests served, by method, route and status.
+# TYPE todolist_http_requests_total counter
+todolist_http_requests_total{method="GET",route="/api/v1/tasks/{id}",status="200"} 2
+todolist_http_requests_total{method="GET",route="/api/v1/tasks/{id}",status="404"} 1
+todolist_http_requests_total{method="GET",route="unknown",status="404"} 1
+`
+	err := testutil.GatherAndCompare(m.Registry, strings.NewReader(expected), "todolist_http_requests_total")
+	assert.NoError(t, err)
+}
+
+func TestQueryHook(t *testing.T) {
+	m := metrics.New()
+	for _, err := range []error{nil, database.ErrVersionMismatch, errors.New("connection reset")} {
+		_, end := m.QueryHook(context.Background(), "EditTask")
+		end(err)
+	}
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.Registry, "todolist_db_call_duration_seconds"))
+}
+
+func TestTaskCounters(t *testing.T) {
+	m := metrics.New()
+	m.TaskCreated()
+	m.TaskCreated()
+	m.TaskCompleted()
+
+	expected := `
+# HELP todolist_tasks_completed_total Number of tasks marked as done.
+# TYPE todolist_tasks_completed_total counter
+todolist_tasks_completed_total 1
+# HELP todolist_tasks_created_total Number of tasks created.
+# TYPE todolist_tasks_created_total counter
+todolist_tasks_created_total 2
+`
+	err := testutil.GatherAndCompare(m.Registry, strings.NewReader(expected), "todolist_tasks_created_total", "todolist_tasks_completed_total")
+	assert.NoError(t, err)
+
+	// Handlers built without metrics do not count anything
+	var none *metrics.Metrics
+	none.TaskCreated()
+}
+
+func TestHandler(t *testing.T) {
+	m := metrics.New()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Thybaau/todolist-app/auth"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	requestIDKey
+)
+
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// Principal is the authenticated caller of a request, either a login
+// session or an API key
+type Principal struct {
+	UserID    int64
+	SessionID int64
+	APIKeyID  int64
+	Scope     string
+}
+
+// CanWrite reports whether the principal may modify data
+func (p *Principal) CanWrite() bool {
+	return p.Scope == auth.ScopeReadWrite
+}
+
+// Authenticator checks the bearer token of a request and returns its principal
+type Authenticator func(r *http.Request, token string) (*Principal, error)
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer" token
+// with 401, and requests modifying data with a read-only principal with 403.
+// It stores the principal in the context of the others.
+func RequireAuth(authenticate Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticate(r, BearerToken(r))
+			if errors.Is(err, ErrUnauthenticated) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="todolist"`)
+				NewHTTPError(w, r, "Authentication required", http.StatusUnauthorized, err)
+				return
+			}
+			if err != nil {
+				WriteError(w, r, "Cannot authenticate request", err)
+				return
+			}
+			if !principal.CanWrite() && !isSafeMethod(r.Method) {
+				NewHTTPError(w, r, "Read-only credentials cannot modify data", http.StatusForbidden, nil)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// BearerToken returns the token of the Authorization header, or "" if there is none
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFrom returns the principal set by RequireAuth
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok
+}
+
+// UserID returns the ID of the authenticated user, set by RequireAuth
+func UserID(ctx context.Context) (int64, bool) {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return 0, false
+	}
+	return p.UserID, true
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize is the maximum size of a request body, in bytes
+const MaxBodySize = 1 << 20
+
+// DecodeJSON decodes the JSON body of a request into dst. The body must be a
+// single JSON value of at most MaxBodySize bytes, without unknown fields. It
+// writes the error response and returns false if the body cannot be decoded.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, message string) bool {
+	body := http.MaxBytesReader(w, r.Body, MaxBodySize)
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("body must contain a single JSON value")
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, io.EOF):
+		NewHTTPError(w, r, message, http.StatusBadRequest, errors.New("body cannot be empty"))
+	case errors.As(err, &tooLarge):
+		NewHTTPError(w, r, message, http.StatusRequestEntityTooLarge, err)
+	default:
+		NewHTTPError(w, r, message, http.StatusBadRequest, err)
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type request struct {
+		Name string `json:"name"`
+	}
+	for body, status := range map[string]int{
+		`{"name": "alice"}`:                 http.StatusOK,
+		``:                                  http.StatusBadRequest,
+		`{"name": "alice", "admin": true}`:  http.StatusBadRequest,
+		`{"name": "alice"} {"name": "bob"}`: http.StatusBadRequest,
+		`{"name": 42}`:                      http.StatusBadRequest,
+		`{"name": "` + strings.Repeat("a", middleware.MaxBodySize) + `"}`: http.StatusRequestEntityTooLarge,
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/auth/register", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		dst := request{}
+		if middleware.DecodeJSON(w, req, &dst, "Cannot decode body") {
+			assert.Equal(t, "alice", dst.Name)
+			continue
+		}
+		assert.Equal(t, status, w.Code, body)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	v := middleware.Validator{}
+	v.Required("content", middleware.Trim(" \t\n"))
+	v.MaxLength("content", "héllo", 5)
+	v.SingleLine("content", "two\nlines")
+	v.MultiLine("description", "two\nlines\tand a tab")
+	v.MultiLine("description", "bell\a")
+
+	assert.False(t, v.Valid())
+	assert.Equal(t, []middleware.FieldError{
+		{Field: "content", Message: "Key 'content' cannot be empty"},
+		{Field: "content", Message: "Key 'content' cannot contain control characters"},
+		{Field: "description", Message: "Key 'description' cannot contain control characters other than line breaks and tabs"},
+	}, v.Fields)
+}
+
+func TestIsJSON(t *testing.T) {
+	for contentType, ok := range map[string]bool{
+		"application/json":                  true,
+		"application/json; charset=UTF-8":   true,
+		"application/json; charset=utf-16":  false,
+		"application/x-www-form-urlencoded": false,
+	} {
+		assert.Equal(t, ok, middleware.IsJSON(contentType), contentType)
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Deprecated marks the response of a deprecated route, and points to the
+// route replacing it (RFC 8594 and draft-ietf-httpapi-deprecation-header).
+// The Link headers set before are replaced, so that a handler can point to a
+// more precise successor than the one of its route
+func Deprecated(w http.ResponseWriter, successor string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Thybaau/todolist-app/database"
+)
+
+// Stable error codes, returned in the "code" key of error responses so that
+// clients do not depend on messages
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeValidation           = "validation_failed"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal_error"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthenticated,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusNotAcceptable:         CodeNotAcceptable,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeValidation,
+	http.StatusGatewayTimeout:        CodeTimeout,
+	http.StatusInternalServerError:   CodeInternal,
+}
+
+// ErrorCode returns the error code of a response status
+func ErrorCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// ErrorStatus maps an error returned by the database or the middlewares to
+// the status of its response, 500 for unexpected errors. Validation errors
+// are 422 when about a field of the body, 400 otherwise.
+func ErrorStatus(err error) int {
+	switch {
+	case fieldError(err) != nil:
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, database.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError writes the error response of err, with the status and code of
+// its kind
+func WriteError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if fieldErr := fieldError(err); fieldErr != nil {
+		NewValidationError(w, r, message, []FieldError{{Field: fieldErr.Field, Message: fieldErr.Message}})
+		return
+	}
+	NewHTTPError(w, r, message, ErrorStatus(err), err)
+}
+
+// fieldError returns the database validation error about a field of the body
+// wrapped by err, nil if none
+func fieldError(err error) *database.Error {
+	var dbErr *database.Error
+	if errors.As(err, &dbErr) && dbErr.Field != "" && errors.Is(dbErr, database.ErrValidation) {
+		return dbErr
+	}
+	return nil
+}
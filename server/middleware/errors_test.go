@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for err, status := range map[error]int{
+		&database.Error{Kind: database.ErrNotFound, Message: "task 1 not found"}: http.StatusNotFound,
+		database.ErrUsernameTaken:                                http.StatusConflict,
+		database.ErrVersionMismatch:                              http.StatusPreconditionFailed,
+		database.ErrInvalidCursor:                                http.StatusBadRequest,
+		database.ErrParentCycle:                                  http.StatusUnprocessableEntity,
+		fmt.Errorf("wrapped: %w", middleware.ErrUnauthenticated): http.StatusUnauthorized,
+		context.DeadlineExceeded:                                 http.StatusGatewayTimeout,
+		errors.New("connection refused"):                         http.StatusInternalServerError,
+	} {
+		assert.Equal(t, status, middleware.ErrorStatus(err), err.Error())
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/api/v1/tasks/1", nil)
+	w := httptest.NewRecorder()
+	middleware.WriteError(w, req, "Cannot edit task", database.ErrVersionMismatch)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:precondition_failed",
+		"title": "Cannot edit task",
+		"status": 412,
+		"code": "precondition_failed",
+		"detail": "task was modified by another request"
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+func TestWriteErrorField(t *testing.T) {
+	req := httptest.NewRequest("PATCH", "/api/v1/tasks/1", nil)
+	w := httptest.NewRecorder()
+	middleware.WriteError(w, req, "Cannot update task", database.ErrParentCycle)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Cannot update task",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "parent_id", "message": "a task cannot be a subtask of itself or of its subtasks"}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestWriteErrorHidesInternalDetail(t *testing.T) {
+	var requestID string
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = middleware.RequestIDFrom(r.Context())
+		middleware.WriteError(w, r, "Cannot load tasks", errors.New(`pq: relation "tasks" does not exist`))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+
+	expectedResp := fmt.Sprintf(`{
+		"type": "urn:todolist:problem:internal_error",
+		"title": "Cannot load tasks",
+		"status": 500,
+		"code": "internal_error",
+		"instance": "urn:uuid:%s"
+	  }`, requestID)
+	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", requestID)
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
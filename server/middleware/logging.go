@@ -1,27 +1,36 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 	"time"
+
+	"github.com/Thybaau/todolist-app/logging"
 )
 
+// LogRequests logs every request once it is served, with the last logger of
+// its context, including the attributes added by next
 func LogRequests(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		// Create a custom ResponseWriter to get request status code
-		crw := &customResponseWriter{ResponseWriter: w}
+		crw := &customResponseWriter{ResponseWriter: w, status: http.StatusOK}
 
 		// Call the next handler in the chain
-		next.ServeHTTP(crw, r)
+		ctx, logger := logging.NewScope(r.Context())
+		next.ServeHTTP(crw, r.WithContext(ctx))
 
 		// Log request details
-		duration := time.Since(start)
-		log.Printf("[%s] %v - %s %s - %s\n", r.Method, crw.status, r.RequestURI, r.RemoteAddr, duration)
+		logger().Info("Request served",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"status", crw.status,
+			"remote_addr", r.RemoteAddr,
+			"duration", time.Since(start),
+		)
 	})
 }
 
-//ResponseWriter to get request status code
+// ResponseWriter to get request status code
 type customResponseWriter struct {
 	http.ResponseWriter
 	status int
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSONOnly negotiates the media types of the API, which only speaks JSON.
+// Requests whose Accept header excludes application/json get 406, and
+// requests with a body which is not UTF-8 application/json get 415.
+func JSONOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !AcceptsJSON(r.Header.Get("Accept")) {
+			NewHTTPError(w, r, "Responses are only available as application/json", http.StatusNotAcceptable, nil)
+			return
+		}
+		if hasBody(r) && !IsJSON(r.Header.Get("Content-Type")) {
+			w.Header().Set("Accept", "application/json")
+			NewHTTPError(w, r, "Request body must be application/json", http.StatusUnsupportedMediaType, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AcceptsJSON reports whether an Accept header allows a JSON response.
+// An empty header accepts anything.
+func AcceptsJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// IsJSON reports whether a Content-Type header is application/json, with no
+// charset or UTF-8
+func IsJSON(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return false
+	}
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8")
+}
+
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || len(r.TransferEncoding) > 0
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/Thybaau/todolist-app/logging"
+)
+
+// RequestIDHeader carries the ID of a request, from a proxy or a client, and
+// back in the response
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs taken from RequestIDHeader, others are replaced
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Format of the IDs generated by newRequestID
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// RequestID identifies every request by the ID of its RequestIDHeader, or a
+// random one if it has none, and echoes it in the response. The logger of the
+// request context logs this ID with every record.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = logging.NewContext(ctx, logging.FromContext(ctx).With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the ID set by RequestID, or "" if there is none
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// requestURI returns a URI identifying a request from its ID, "" if there is
+// none
+func requestURI(id string) string {
+	switch {
+	case id == "":
+		return ""
+	case uuidPattern.MatchString(id):
+		return "urn:uuid:" + id
+	default:
+		return "urn:todolist:request:" + id
+	}
+}
+
+// newRequestID returns a random UUID (version 4)
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
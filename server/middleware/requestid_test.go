@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/logging"
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDFromHeader(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "info", "text")
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "f3a1c0de42", middleware.RequestIDFrom(r.Context()))
+		logging.FromContext(r.Context()).Info("handled")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req = req.WithContext(logging.NewContext(req.Context(), logger))
+	req.Header.Set(middleware.RequestIDHeader, "f3a1c0de42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "f3a1c0de42", w.Header().Get(middleware.RequestIDHeader))
+	assert.Contains(t, buf.String(), "msg=handled request_id=f3a1c0de42")
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	for _, header := range []string{"", "not a valid id\n"} {
+		var requestID string
+		handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID = middleware.RequestIDFrom(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+		req.Header.Set(middleware.RequestIDHeader, header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", requestID)
+		assert.Equal(t, requestID, w.Header().Get(middleware.RequestIDHeader))
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := middleware.LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/api/v1/tasks/2", nil)
+	req = req.WithContext(logging.NewContext(req.Context(), logger.With("request_id", "abc")))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, buf.String(), `"msg":"Request served","request_id":"abc","method":"DELETE","uri":"/api/v1/tasks/2","status":204`)
+}
@@ -2,40 +2,84 @@ package middleware
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/Thybaau/todolist-app/logging"
 )
 
-type HTTPError struct {
-	Error  string `json:"error"`
-	Detail string `json:"detail"`
+// Problem is an error response, following RFC 7807 (application/problem+json)
+type Problem struct {
+	// URI of the kind of problem, built from Code
+	Type string `json:"type"`
+	// Short summary of the problem
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Explanation of this occurrence, omitted for server errors
+	Detail string `json:"detail,omitempty"`
+	// Identifies the request in the server logs
+	Instance string `json:"instance,omitempty"`
+	// Stable error code, see the Code constants
+	Code string `json:"code"`
+	// Invalid fields of the request, if any
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
-func NewHTTPError(w http.ResponseWriter, message string, status int, err error) {
-	var resp HTTPError
-	switch err {
-	case nil:
-		logMessage := message + "\n"
-		log.Print(logMessage)
-		resp = HTTPError{
-			Error: message,
-		}
-	default:
-		logMessage := message + ". err = " + err.Error() + "\n"
-		log.Print(logMessage)
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Prefix of the type of problems, followed by their code
+const ProblemTypePrefix = "urn:todolist:problem:"
+
+// NewHTTPError writes a problem response. The details of err are only sent
+// to the client for client errors, they are logged for server errors.
+func NewHTTPError(w http.ResponseWriter, r *http.Request, message string, status int, err error) {
+	writeProblem(w, r, message, status, ErrorCode(status), err, nil)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, message string, status int, code string, err error, fields []FieldError) {
+	problem := Problem{
+		Type:   ProblemTypePrefix + code,
+		Title:  message,
+		Status: status,
+		Code:   code,
+		Errors: fields,
+	}
+	problem.Instance = requestURI(RequestIDFrom(r.Context()))
 
-		resp = HTTPError{
-			Error:  message,
-			Detail: err.Error(),
+	// Server errors are logged with their details, which are not sent back
+	logger := logging.FromContext(r.Context())
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := []any{"status", status, "code", code}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+		if status < http.StatusInternalServerError {
+			problem.Detail = err.Error()
 		}
 	}
-	JSONResponse(w, status, resp)
+	logger.Log(r.Context(), level, message, attrs...)
+
+	resp, err := json.Marshal(problem)
+	if err != nil {
+		logger.Error("Cannot encode json", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(resp)
 }
 
 func JSONResponse(w http.ResponseWriter, status int, content interface{}) {
 	resp, err := json.Marshal(content)
 	if err != nil {
-		log.Printf("Cannot encode json, err =%v\n", err)
+		slog.Error("Cannot encode json", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 	w.Header().Set("Content-Type", "application/json")
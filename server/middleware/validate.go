@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validator collects the invalid fields of a request body, to report them
+// all in a single response
+type Validator struct {
+	Fields []FieldError
+}
+
+// Valid reports whether no field is invalid
+func (v *Validator) Valid() bool {
+	return len(v.Fields) == 0
+}
+
+// Check records message for field if ok is false
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Fields = append(v.Fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// Required checks that value is not empty
+func (v *Validator) Required(field, value string) {
+	v.Check(value != "", field, fmt.Sprintf("Key '%s' cannot be empty", field))
+}
+
+// MaxLength checks that value has at most max characters
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("Key '%s' cannot be longer than %d characters", field, max))
+}
+
+// SingleLine checks that value is valid UTF-8 without control characters
+func (v *Validator) SingleLine(field, value string) {
+	v.Check(printable(value, ""), field, fmt.Sprintf("Key '%s' cannot contain control characters", field))
+}
+
+// MultiLine checks that value is valid UTF-8 without control characters
+// other than line breaks and tabs
+func (v *Validator) MultiLine(field, value string) {
+	v.Check(printable(value, "\n\r\t"), field, fmt.Sprintf("Key '%s' cannot contain control characters other than line breaks and tabs", field))
+}
+
+func printable(value, allowed string) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+	for _, c := range value {
+		if unicode.IsControl(c) && !strings.ContainsRune(allowed, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Trim removes the white space around a text field. Fields are trimmed before
+// being checked and stored, so that blank values are empty.
+func Trim(value string) string {
+	return strings.TrimSpace(value)
+}
+
+// NewValidationError writes a 422 problem response listing the invalid fields
+// of a request
+func NewValidationError(w http.ResponseWriter, r *http.Request, message string, fields []FieldError) {
+	writeProblem(w, r, message, http.StatusUnprocessableEntity, CodeValidation, nil, fields)
+}
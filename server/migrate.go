@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Thybaau/todolist-app/config"
+	"github.com/Thybaau/todolist-app/database"
+)
+
+// migrate runs the `migrate [up | down [steps] | version]` subcommand
+func migrate(cfg *config.Config) error {
+	action := "up"
+	if len(cfg.Args) > 0 {
+		action = cfg.Args[0]
+	}
+
+	store := &database.DBStore{QueryTimeout: time.Duration(cfg.DB.QueryTimeout)}
+	err := store.Connect(context.Background(), cfg.DB.Host, cfg.DB.Port, cfg.DB.User, cfg.DB.Password, cfg.DB.Name)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	migrator, err := database.NewMigrator(store.DB)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		steps := 1
+		if len(cfg.Args) > 1 {
+			steps, err = strconv.Atoi(cfg.Args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", cfg.Args[1])
+			}
+		}
+		err = migrator.Down(steps)
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down or version", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	slog.Info("Schema version", "version", version, "latest", migrator.Latest())
+	return nil
+}
@@ -0,0 +1,389 @@
+// Package recurrence parses the schedules of recurring tasks, a subset of the
+// RRULE of RFC 5545, and computes their next occurrence.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency of a rule, its unit of time
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// Bounds of the numbers of a rule
+const (
+	MaxInterval = 999
+	MaxCount    = 999
+)
+
+// Format of UNTIL, as a date or a UTC date and time
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+)
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Weekday of BYDAY. In monthly rules, N selects the Nth such day of the month,
+// counted from its end when negative, and 0 every such day.
+type Weekday struct {
+	N   int
+	Day time.Weekday
+}
+
+func (w Weekday) String() string {
+	if w.N == 0 {
+		return weekdayNames[w.Day]
+	}
+	return strconv.Itoa(w.N) + weekdayNames[w.Day]
+}
+
+// Rule is a recurrence rule, such as FREQ=WEEKLY;BYDAY=MO,WE or
+// FREQ=MONTHLY;BYDAY=-1FR for the last Friday of every month
+type Rule struct {
+	Freq Frequency
+	// Number of days, weeks or months between occurrences, at least 1
+	Interval int
+	// Only these days, in daily, weekly and monthly rules
+	ByDay []Weekday
+	// Only these days of the month, from its end when negative, in monthly
+	// rules
+	ByMonthDay []int
+	// Number of occurrences left including the current one, 0 for no limit
+	Count int
+	// Last time of an occurrence, nil for no limit
+	Until *time.Time
+	// UNTIL was given as a date, to format it back the same way
+	untilDate bool
+}
+
+// Parse parses and validates a rule, with or without an RRULE: prefix. Parts
+// are separated by semicolons, in any order and case.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("rule cannot be empty")
+	}
+	r := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%q is not a NAME=VALUE part", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return nil, fmt.Errorf("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			r.Interval, err = parseNumber(name, value, 1, MaxInterval)
+		case "COUNT":
+			r.Count, err = parseNumber(name, value, 1, MaxCount)
+		case "UNTIL":
+			err = r.parseUntil(value)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				w, err := parseWeekday(day)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, w)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				d, err := strconv.Atoi(day)
+				if err != nil || d == 0 || d < -31 || d > 31 {
+					return nil, fmt.Errorf("BYMONTHDAY must be days between 1 and 31, or -31 and -1")
+				}
+				r.ByMonthDay = append(r.ByMonthDay, d)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, r.validate()
+}
+
+func parseNumber(name, value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return n, nil
+}
+
+func (r *Rule) parseUntil(value string) error {
+	if t, err := time.Parse(dateFormat, value); err == nil {
+		// A date includes the whole day
+		until := t.Add(24*time.Hour - time.Second)
+		r.Until, r.untilDate = &until, true
+		return nil
+	}
+	t, err := time.Parse(dateTimeFormat, value)
+	if err != nil {
+		return fmt.Errorf("UNTIL must be a date such as 20240131 or a UTC time such as 20240131T090000Z")
+	}
+	r.Until = &t
+	return nil
+}
+
+func parseWeekday(s string) (Weekday, error) {
+	w := Weekday{}
+	if len(s) < 2 {
+		return w, fmt.Errorf("%q is not a day such as MO or -1FR", s)
+	}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return w, fmt.Errorf("%q is not a day such as MO or -1FR", s)
+		}
+		w.N = n
+	}
+	for day, name := range weekdayNames {
+		if s[len(s)-2:] == name {
+			w.Day = time.Weekday(day)
+			return w, nil
+		}
+	}
+	return w, fmt.Errorf("%q is not a day such as MO or -1FR", s)
+}
+
+func (r *Rule) validate() error {
+	if r.Freq == "" {
+		return fmt.Errorf("FREQ is required")
+	}
+	if r.Count != 0 && r.Until != nil {
+		return fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return fmt.Errorf("BYMONTHDAY is only allowed in monthly rules")
+	}
+	if len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 {
+		return fmt.Errorf("BYDAY and BYMONTHDAY cannot be combined")
+	}
+	for _, w := range r.ByDay {
+		if w.N != 0 && r.Freq != Monthly {
+			return fmt.Errorf("numbered days such as %s are only allowed in monthly rules", w)
+		}
+	}
+	// Every such occurrence falls on the weekday of the first one, which
+	// BYDAY would only keep or never match
+	if r.Freq == Daily && r.Interval%7 == 0 && len(r.ByDay) > 0 {
+		return fmt.Errorf("BYDAY cannot be combined with an INTERVAL multiple of 7 in daily rules, use a weekly rule")
+	}
+	return nil
+}
+
+// String formats the rule in a canonical form, parsed back by Parse
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, w := range r.ByDay {
+			days[i] = w.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format(dateFormat))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format(dateTimeFormat))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence strictly after the occurrence at t, at
+// the same time of day in the location of t, with the rule of the next
+// occurrence. It returns false when the rule has no more occurrences.
+func (r *Rule) Next(t time.Time) (time.Time, *Rule, bool) {
+	if r.Count == 1 {
+		return time.Time{}, nil, false
+	}
+
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case Daily:
+		next, ok = r.nextDaily(t)
+	case Weekly:
+		next, ok = r.nextWeekly(t)
+	case Monthly:
+		next, ok = r.nextMonthly(t)
+	}
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, nil, false
+	}
+
+	rest := *r
+	if rest.Count > 0 {
+		rest.Count--
+	}
+	return next, &rest, true
+}
+
+// CheckFrom returns an error if the rule has no occurrence after the one at t,
+// whatever its COUNT and UNTIL. Monthly rules can reach only months without
+// their days, such as FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30 from February.
+func (r *Rule) CheckFrom(t time.Time) error {
+	unlimited := *r
+	unlimited.Count, unlimited.Until = 0, nil
+	if _, _, ok := unlimited.Next(t); !ok {
+		return fmt.Errorf("rule has no occurrence after %s", t.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// matchesDay reports whether t is one of the days of ByDay, any day if empty.
+// Numbered days are handled by nextMonthly.
+func (r *Rule) matchesDay(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, w := range r.ByDay {
+		if w.Day == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) nextDaily(t time.Time) (time.Time, bool) {
+	// Weekdays repeat after at most 7 steps, and every weekday is reached
+	// since validate rejects BYDAY with intervals multiple of 7
+	for k := 1; k <= 7; k++ {
+		next := t.AddDate(0, 0, k*r.Interval)
+		if r.matchesDay(next) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) nextWeekly(t time.Time) (time.Time, bool) {
+	// Weeks start on Monday, as the default WKST of RFC 5545
+	start := weekStart(t)
+	for d := 1; d <= 7*r.Interval+7; d++ {
+		next := t.AddDate(0, 0, d)
+		weeks := daysBetween(start, weekStart(next)) / 7
+		if weeks%r.Interval != 0 {
+			continue
+		}
+		// Without BYDAY, occurrences keep the weekday of t
+		matches := next.Weekday() == t.Weekday()
+		if len(r.ByDay) > 0 {
+			matches = r.matchesDay(next)
+		}
+		if matches {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) nextMonthly(t time.Time) (time.Time, bool) {
+	// The lengths of months repeat every 4 years
+	year, month, _ := t.Date()
+	hour, min, sec := t.Clock()
+	for k := 0; k <= 48; k++ {
+		first := time.Date(year, month+time.Month(k*r.Interval), 1, hour, min, sec, t.Nanosecond(), t.Location())
+		for _, day := range r.monthDays(t, first) {
+			next := first.AddDate(0, 0, day-1)
+			if next.After(t) {
+				return next, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// monthDays returns the sorted days of the month starting at first matching
+// the rule, t being the occurrence the rule started from
+func (r *Rule) monthDays(t, first time.Time) []int {
+	length := first.AddDate(0, 1, -1).Day()
+	days := []int{}
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d += length + 1
+			}
+			if d >= 1 && d <= length {
+				days = append(days, d)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, w := range r.ByDay {
+			// First day of the month with this weekday
+			firstDay := 1 + (int(w.Day)-int(first.Weekday())+7)%7
+			all := []int{}
+			for d := firstDay; d <= length; d += 7 {
+				all = append(all, d)
+			}
+			switch {
+			case w.N == 0:
+				days = append(days, all...)
+			case w.N > 0 && w.N <= len(all):
+				days = append(days, all[w.N-1])
+			case w.N < 0 && -w.N <= len(all):
+				days = append(days, all[len(all)+w.N])
+			}
+		}
+	default:
+		// Months without the day of t are skipped
+		if t.Day() <= length {
+			days = append(days, t.Day())
+		}
+	}
+	sort.Ints(days)
+	return days
+}
+
+// weekStart returns the Monday of the week of t
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// daysBetween returns the number of calendar days from a to b, ignoring
+// daylight saving time changes
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	da := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	db := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
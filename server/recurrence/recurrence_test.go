@@ -0,0 +1,141 @@
+package recurrence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Thybaau/todolist-app/recurrence"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"FREQ=DAILY":                            "FREQ=DAILY",
+		"rrule:freq=weekly;byday=mo,we":         "FREQ=WEEKLY;BYDAY=MO,WE",
+		"FREQ=MONTHLY;BYDAY=-1FR":               "FREQ=MONTHLY;BYDAY=-1FR",
+		"INTERVAL=2;FREQ=MONTHLY;BYMONTHDAY=-1": "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=-1",
+		"FREQ=DAILY;INTERVAL=1;COUNT=3":         "FREQ=DAILY;COUNT=3",
+		"FREQ=WEEKLY;UNTIL=20240331":            "FREQ=WEEKLY;UNTIL=20240331",
+		"FREQ=WEEKLY;UNTIL=20240331T120000Z":    "FREQ=WEEKLY;UNTIL=20240331T120000Z",
+		"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR":       "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+		" FREQ=MONTHLY;BYDAY=1MO,3MO;COUNT=12 ": "FREQ=MONTHLY;BYDAY=1MO,3MO;COUNT=12",
+	}
+	for input, expected := range tests {
+		r, err := recurrence.Parse(input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, r.String(), input)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"":                                    "rule cannot be empty",
+		"FREQ=YEARLY":                         "FREQ must be DAILY, WEEKLY or MONTHLY",
+		"INTERVAL=2":                          "FREQ is required",
+		"FREQ=DAILY;FREQ=WEEKLY":              "FREQ is given twice",
+		"FREQ=DAILY;INTERVAL=0":               "INTERVAL must be between 1 and 999",
+		"FREQ=DAILY;BYSETPOS=1":               "unsupported part BYSETPOS",
+		"FREQ=DAILY;COUNT":                    `"COUNT" is not a NAME=VALUE part`,
+		"FREQ=WEEKLY;BYDAY=XX":                `"XX" is not a day such as MO or -1FR`,
+		"FREQ=WEEKLY;BYDAY=-1FR":              "numbered days such as -1FR are only allowed in monthly rules",
+		"FREQ=WEEKLY;BYMONTHDAY=1":            "BYMONTHDAY is only allowed in monthly rules",
+		"FREQ=MONTHLY;BYMONTHDAY=32":          "BYMONTHDAY must be days between 1 and 31, or -31 and -1",
+		"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13": "BYDAY and BYMONTHDAY cannot be combined",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240101":   "COUNT and UNTIL cannot be combined",
+		"FREQ=DAILY;UNTIL=2024-01-01":         "UNTIL must be a date such as 20240131 or a UTC time such as 20240131T090000Z",
+		"FREQ=DAILY;INTERVAL=7;BYDAY=MO":      "BYDAY cannot be combined with an INTERVAL multiple of 7 in daily rules, use a weekly rule",
+	}
+	for input, expected := range tests {
+		_, err := recurrence.Parse(input)
+		assert.EqualError(t, err, expected, input)
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		rule     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"FREQ=DAILY", date(2024, 2, 28), date(2024, 2, 29)},
+		{"FREQ=DAILY;INTERVAL=3", date(2024, 2, 28), date(2024, 3, 2)},
+		// Friday to Monday, every weekday
+		{"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", date(2024, 3, 1), date(2024, 3, 4)},
+		// Tuesday, then every other day until a Monday
+		{"FREQ=DAILY;INTERVAL=2;BYDAY=MO", date(2024, 3, 5), date(2024, 3, 11)},
+		{"FREQ=DAILY;INTERVAL=13;BYDAY=SU", date(2024, 3, 5), date(2024, 3, 31)},
+		{"FREQ=WEEKLY", date(2024, 3, 1), date(2024, 3, 8)},
+		// Wednesday to Friday of the same week, then Monday of the next one
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(2024, 2, 28), date(2024, 3, 1)},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(2024, 3, 1), date(2024, 3, 4)},
+		// Every other week skips the next one
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", date(2024, 3, 1), date(2024, 3, 11)},
+		{"FREQ=MONTHLY", date(2024, 1, 15), date(2024, 2, 15)},
+		// Months without a 31st are skipped
+		{"FREQ=MONTHLY", date(2024, 1, 31), date(2024, 3, 31)},
+		{"FREQ=MONTHLY;BYDAY=-1FR", date(2024, 3, 29), date(2024, 4, 26)},
+		{"FREQ=MONTHLY;BYDAY=-1FR", date(2024, 3, 10), date(2024, 3, 29)},
+		{"FREQ=MONTHLY;BYDAY=1MO,3MO", date(2024, 3, 4), date(2024, 3, 18)},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(2024, 1, 31), date(2024, 2, 29)},
+		{"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=1,15", date(2024, 1, 15), date(2024, 4, 1)},
+	}
+	for _, test := range tests {
+		r, err := recurrence.Parse(test.rule)
+		if err != nil {
+			t.Fatalf("Error while parsing %s : %s", test.rule, err)
+		}
+		next, rest, ok := r.Next(test.from)
+		if assert.True(t, ok, test.rule) {
+			assert.Equal(t, test.expected, next, test.rule)
+			assert.Equal(t, r.String(), rest.String(), test.rule)
+		}
+	}
+}
+
+func TestNextLimits(t *testing.T) {
+	r, _ := recurrence.Parse("FREQ=DAILY;COUNT=2")
+	next, rest, ok := r.Next(date(2024, 3, 1))
+	assert.True(t, ok)
+	assert.Equal(t, date(2024, 3, 2), next)
+	assert.Equal(t, "FREQ=DAILY;COUNT=1", rest.String())
+	_, _, ok = rest.Next(next)
+	assert.False(t, ok)
+
+	// UNTIL includes its whole day
+	r, _ = recurrence.Parse("FREQ=DAILY;UNTIL=20240302")
+	_, _, ok = r.Next(date(2024, 3, 1))
+	assert.True(t, ok)
+	_, _, ok = r.Next(date(2024, 3, 2))
+	assert.False(t, ok)
+
+	// The 30th of February never comes
+	r, _ = recurrence.Parse("FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30")
+	_, _, ok = r.Next(date(2024, 2, 1))
+	assert.False(t, ok)
+}
+
+func TestCheckFrom(t *testing.T) {
+	r, _ := recurrence.Parse("FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30")
+	assert.EqualError(t, r.CheckFrom(date(2024, 2, 1)), "rule has no occurrence after 2024-02-01")
+	assert.NoError(t, r.CheckFrom(date(2024, 3, 1)))
+
+	// Limits are not checked, the last occurrence has no next one
+	r, _ = recurrence.Parse("FREQ=DAILY;COUNT=1")
+	assert.NoError(t, r.CheckFrom(date(2024, 3, 1)))
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Time zone database not available")
+	}
+	// Daylight saving time starts on March 31 in Paris
+	r, _ := recurrence.Parse("FREQ=DAILY")
+	next, _, _ := r.Next(time.Date(2024, 3, 30, 9, 0, 0, 0, paris))
+	assert.Equal(t, time.Date(2024, 3, 31, 9, 0, 0, 0, paris), next)
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Thybaau/todolist-app/auth"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+// Maximum length of the name of an API key, in characters
+const maxAPIKeyNameLength = 100
+
+type jsonAPIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func toJSONAPIKey(k *database.APIKey) jsonAPIKey {
+	return jsonAPIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Scope:      k.Scope,
+		Prefix:     k.Prefix,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+	}
+}
+
+func (s *server) handleAPIKeyCreate() http.HandlerFunc {
+	type request struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Decode and check fields in request
+		req := request{}
+		if !middleware.DecodeJSON(w, r, &req, "Cannot decode API key body from json") {
+			return
+		}
+		req.Name = middleware.Trim(req.Name)
+		v := middleware.Validator{}
+		v.Required("name", req.Name)
+		v.MaxLength("name", req.Name, maxAPIKeyNameLength)
+		v.SingleLine("name", req.Name)
+		v.Check(auth.ValidScope(req.Scope), "scope", fmt.Sprintf("Key 'scope' must be %q or %q", auth.ScopeRead, auth.ScopeReadWrite))
+		if !v.Valid() {
+			middleware.NewValidationError(w, r, "API key is not valid", v.Fields)
+			return
+		}
+
+		// Insert key in database
+		key, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Cannot create API key", http.StatusInternalServerError, err)
+			return
+		}
+		userID, _ := middleware.UserID(r.Context())
+		k := &database.APIKey{
+			UserID:  userID,
+			Name:    req.Name,
+			Prefix:  prefix,
+			KeyHash: hash,
+			Scope:   req.Scope,
+		}
+		if _, err := s.DB.CreateAPIKey(r.Context(), k); err != nil {
+			middleware.WriteError(w, r, "Cannot create API key", err)
+			return
+		}
+
+		// Write response, the only time the key is shown
+		resp := toJSONAPIKey(k)
+		resp.Key = key
+		middleware.JSONResponse(w, http.StatusCreated, resp)
+	}
+}
+
+func (s *server) handleAPIKeyList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.UserID(r.Context())
+		keys, err := s.DB.ListAPIKeys(r.Context(), userID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load API keys", err)
+			return
+		}
+		resp := make([]jsonAPIKey, len(keys))
+		for i, k := range keys {
+			resp[i] = toJSONAPIKey(k)
+		}
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
+
+func (s *server) handleAPIKeyRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract key ID
+		vars := mux.Vars(r)
+		keyID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid API key ID", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		err = s.DB.RevokeAPIKey(r.Context(), userID, keyID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot revoke API key", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// sessionOnly rejects requests authenticated with an API key, so that a
+// leaked key cannot be used to create new ones
+func sessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := middleware.PrincipalFrom(r.Context())
+		if !ok || principal.SessionID == 0 {
+			middleware.NewHTTPError(w, r, "API keys can only be managed from a login session", http.StatusForbidden, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
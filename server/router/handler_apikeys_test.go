@@ -0,0 +1,197 @@
+package router
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/auth"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const useAPIKey = "UPDATE api_keys SET last_used_at = now()"
+
+func apiKeyRows(scope string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scope", "created_at", "last_used_at"}).
+		AddRow(4, testUserID, "cron", "tdk_abcdef", scope, time.Now(), time.Now())
+}
+
+func TestHandleAPIKeyCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO api_keys (user_id,name,prefix,key_hash,scope) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at")).
+		WithArgs(testUserID, "cron", sqlmock.AnyArg(), sqlmock.AnyArg(), auth.ScopeReadWrite).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, createdAt))
+
+	requestBody := []byte(`{"name": "cron", "scope": "read-write"}`)
+	req := httptest.NewRequest("POST", "/auth/keys", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleAPIKeyCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp jsonAPIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode response : %s", err)
+	}
+	assert.Equal(t, int64(4), resp.ID)
+	assert.True(t, strings.HasPrefix(resp.Key, auth.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(resp.Key, resp.Prefix))
+	assert.Equal(t, createdAt, resp.CreatedAt)
+}
+
+func TestHandleAPIKeyCreateBadScope(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"name": "cron", "scope": "admin"}`)
+	req := httptest.NewRequest("POST", "/auth/keys", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleAPIKeyCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "API key is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "scope", "message": "Key 'scope' must be \"read\" or \"read-write\""}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleAPIKeyRevokeNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectExec("UPDATE api_keys SET revoked_at = now\\(\\)").
+		WithArgs(4, testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	req := httptest.NewRequest("DELETE", "/auth/keys/4", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "4"})
+	w := httptest.NewRecorder()
+	srv.handleAPIKeyRevoke()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReadOnlyAPIKeyCannotWrite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(useAPIKey).WithArgs(auth.HashToken("tdk_readonly")).WillReturnRows(apiKeyRows(auth.ScopeRead))
+
+	requestBody := []byte(`{"content": "from cron"}`)
+	req := httptest.NewRequest("POST", "/api/v1/tasks", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer tdk_readonly")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAPIKeyCreatesTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(useAPIKey).WithArgs(auth.HashToken("tdk_readwrite")).WillReturnRows(apiKeyRows(auth.ScopeReadWrite))
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
+	mock.ExpectQuery(regexp.QuoteMeta(insert)).
+		WithArgs(testUserID, nil, "from cron", "", false, database.PriorityNone, nil, nil, false, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(1, testTime, testTime, 1))
+
+	requestBody := []byte(`{"content": "from cron"}`)
+	req := httptest.NewRequest("POST", "/api/v1/tasks", bytes.NewBuffer(requestBody))
+	req.Header.Set("Authorization", "Bearer tdk_readwrite")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAPIKeyCannotManageKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(useAPIKey).WithArgs(auth.HashToken("tdk_readwrite")).WillReturnRows(apiKeyRows(auth.ScopeReadWrite))
+
+	req := httptest.NewRequest("GET", "/api/v1/auth/keys", nil)
+	req.Header.Set("Authorization", "Bearer tdk_readwrite")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRevokedAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(useAPIKey).WithArgs(auth.HashToken("tdk_revoked")).WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("Authorization", "Bearer tdk_revoked")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
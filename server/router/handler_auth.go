@@ -1,12 +1,239 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Thybaau/todolist-app/auth"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
 )
 
+var validUsername = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+type jsonUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type jsonTokens struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
 func (s *server) handleIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Welcome to Todo-List by Thibault")
 	}
 }
+
+func (s *server) handleRegister() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Decode and check fields in request
+		req := credentials{}
+		if !middleware.DecodeJSON(w, r, &req, "Cannot decode user body from json") {
+			return
+		}
+		v := middleware.Validator{}
+		v.Check(validUsername.MatchString(req.Username), "username", "Key 'username' must be 3 to 32 letters, digits, '_', '.' or '-'")
+		hash, err := auth.HashPassword(req.Password)
+		if errors.Is(err, auth.ErrPasswordLength) {
+			v.Check(false, "password", fmt.Sprintf("Key 'password' must be between %d and %d bytes long", auth.MinPasswordLength, auth.MaxPasswordLength))
+		} else if err != nil {
+			middleware.NewHTTPError(w, r, "Cannot hash password", http.StatusInternalServerError, err)
+			return
+		}
+		if !v.Valid() {
+			middleware.NewValidationError(w, r, "User is not valid", v.Fields)
+			return
+		}
+
+		// Insert user in database
+		u := &database.User{
+			Username:     req.Username,
+			PasswordHash: hash,
+		}
+		id, err := s.DB.CreateUser(r.Context(), u)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot create user", err)
+			return
+		}
+
+		// Write response
+		resp := jsonUser{
+			ID:       id,
+			Username: u.Username,
+		}
+		middleware.JSONResponse(w, http.StatusCreated, resp)
+	}
+}
+
+func (s *server) handleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := credentials{}
+		if !middleware.DecodeJSON(w, r, &req, "Cannot decode credentials from json") {
+			return
+		}
+
+		user, err := s.checkCredentials(r.Context(), req.Username, req.Password)
+		if errors.Is(err, middleware.ErrUnauthenticated) {
+			middleware.NewHTTPError(w, r, "Invalid username or password", http.StatusUnauthorized, nil)
+			return
+		}
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot check credentials", err)
+			return
+		}
+
+		// Open a new session
+		session, resp, err := s.newSessionTokens()
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Cannot create session", http.StatusInternalServerError, err)
+			return
+		}
+		session.UserID = user.ID
+		if _, err := s.DB.CreateSession(r.Context(), session); err != nil {
+			middleware.WriteError(w, r, "Cannot create session", err)
+			return
+		}
+
+		// Write response
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
+
+func (s *server) handleRefresh() http.HandlerFunc {
+	type request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if !middleware.DecodeJSON(w, r, &req, "Cannot decode refresh token from json") {
+			return
+		}
+		v := middleware.Validator{}
+		v.Required("refresh_token", req.RefreshToken)
+		if !v.Valid() {
+			middleware.NewValidationError(w, r, "Refresh request is not valid", v.Fields)
+			return
+		}
+
+		// Replace both tokens of the session
+		session, resp, err := s.newSessionTokens()
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Cannot refresh session", http.StatusInternalServerError, err)
+			return
+		}
+		err = s.DB.RefreshSession(r.Context(), auth.HashToken(req.RefreshToken), session)
+		if errors.Is(err, database.ErrNotFound) {
+			middleware.NewHTTPError(w, r, "Invalid or expired refresh token", http.StatusUnauthorized, nil)
+			return
+		}
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot refresh session", err)
+			return
+		}
+
+		// Write response
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
+
+func (s *server) handleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := middleware.PrincipalFrom(r.Context())
+		if principal.SessionID == 0 {
+			middleware.NewHTTPError(w, r, "Only login sessions can be logged out", http.StatusBadRequest, nil)
+			return
+		}
+		err := s.DB.RevokeSession(r.Context(), principal.SessionID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			middleware.WriteError(w, r, "Cannot revoke session", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newSessionTokens generates the tokens of a session.
+// The returned session only has its hashes and expiry dates set.
+func (s *server) newSessionTokens() (*database.Session, jsonTokens, error) {
+	accessToken, accessHash, err := auth.NewToken()
+	if err != nil {
+		return nil, jsonTokens{}, err
+	}
+	refreshToken, refreshHash, err := auth.NewToken()
+	if err != nil {
+		return nil, jsonTokens{}, err
+	}
+
+	now := time.Now()
+	session := &database.Session{
+		AccessTokenHash:  accessHash,
+		AccessExpiresAt:  now.Add(s.AccessTokenTTL),
+		RefreshTokenHash: refreshHash,
+		RefreshExpiresAt: now.Add(s.RefreshTokenTTL),
+	}
+	tokens := jsonTokens{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.AccessTokenTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(s.RefreshTokenTTL.Seconds()),
+	}
+	return session, tokens, nil
+}
+
+// authenticate identifies the caller of a request from its access token or API key
+func (s *server) authenticate(r *http.Request, token string) (*middleware.Principal, error) {
+	if token == "" {
+		return nil, middleware.ErrUnauthenticated
+	}
+	if auth.IsAPIKey(token) {
+		key, err := s.DB.UseAPIKey(r.Context(), auth.HashToken(token))
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, middleware.ErrUnauthenticated
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &middleware.Principal{UserID: key.UserID, APIKeyID: key.ID, Scope: key.Scope}, nil
+	}
+
+	session, err := s.DB.GetSessionByAccessToken(r.Context(), auth.HashToken(token))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, middleware.ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &middleware.Principal{UserID: session.UserID, SessionID: session.ID, Scope: auth.ScopeReadWrite}, nil
+}
+
+func (s *server) checkCredentials(ctx context.Context, username, password string) (*database.User, error) {
+	user, err := s.DB.GetUserByUsername(ctx, username)
+	if errors.Is(err, database.ErrNotFound) {
+		// Still compare a hash to not leak which usernames exist
+		auth.CheckPassword("", password)
+		return nil, middleware.ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return nil, middleware.ErrUnauthenticated
+	}
+	return user, nil
+}
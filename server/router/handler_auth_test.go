@@ -0,0 +1,346 @@
+package router
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/auth"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const selectUser = "SELECT id, username, password_hash, created_at FROM users WHERE username = $1"
+
+const selectSession = "SELECT id, user_id, access_expires_at, refresh_expires_at FROM sessions"
+
+func sessionRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "access_expires_at", "refresh_expires_at"}).
+		AddRow(3, testUserID, time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+}
+
+func userRows(t *testing.T, password string) *sqlmock.Rows {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatalf("Error while hashing password : %s", err)
+	}
+	return sqlmock.NewRows([]string{"id", "username", "password_hash", "created_at"}).
+		AddRow(testUserID, "alice", hash, time.Now())
+}
+
+func TestHandleRegister(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	// The first user gets the tasks created before authentication
+	insert := regexp.QuoteMeta("INSERT INTO users (username,password_hash) VALUES ($1, $2) RETURNING id") +
+		`.*` + regexp.QuoteMeta("UPDATE tasks SET user_id = (SELECT id FROM created)") +
+		`\s+` + regexp.QuoteMeta("WHERE user_id IS NULL AND NOT EXISTS (SELECT 1 FROM users)")
+	mock.ExpectQuery("(?s)"+insert).
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testUserID))
+
+	requestBody := []byte(`{"username": "alice", "password": "correct horse"}`)
+	req := httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleRegister()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.JSONEq(t, `{"id": 7, "username": "alice"}`, w.Body.String())
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestHandleRegisterUsernameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	insert := "INSERT INTO users (username,password_hash) VALUES ($1, $2) RETURNING id"
+	mock.ExpectQuery(regexp.QuoteMeta(insert)).
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	requestBody := []byte(`{"username": "alice", "password": "correct horse"}`)
+	req := httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleRegister()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:conflict",
+		"title": "Cannot create user",
+		"status": 409,
+		"code": "conflict",
+		"detail": "username already taken"
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestHandleRegisterShortPassword(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"username": "alice", "password": "short"}`)
+	req := httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleRegister()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "User is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "password", "message": "Key 'password' must be between 8 and 72 bytes long"}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectUser)).WithArgs("alice").WillReturnRows(userRows(t, "correct horse"))
+	mock.ExpectQuery("INSERT INTO sessions").
+		WithArgs(testUserID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	requestBody := []byte(`{"username": "alice", "password": "correct horse"}`)
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleLogin()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp jsonTokens
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode response : %s", err)
+	}
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.NotEqual(t, resp.AccessToken, resp.RefreshToken)
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, int64(900), resp.ExpiresIn)
+}
+
+func TestHandleLoginUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectUser)).WithArgs("bob").WillReturnError(sql.ErrNoRows)
+
+	requestBody := []byte(`{"username": "bob", "password": "correct horse"}`)
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleLogin()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:unauthenticated",
+		"title": "Invalid username or password",
+		"status": 401,
+		"code": "unauthenticated"
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandleLoginDatabaseError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectUser)).WithArgs("bob").WillReturnError(errors.New("connection refused"))
+
+	requestBody := []byte(`{"username": "bob", "password": "correct horse"}`)
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleLogin()(w, req)
+
+	// An outage is not reported as bad credentials
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"Cannot check credentials"`)
+}
+
+func TestHandleRefresh(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery("UPDATE sessions").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), auth.HashToken("old-refresh")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, testUserID))
+
+	requestBody := []byte(`{"refresh_token": "old-refresh"}`)
+	req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleRefresh()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp jsonTokens
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode response : %s", err)
+	}
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.NotEqual(t, "old-refresh", resp.RefreshToken)
+}
+
+func TestHandleRefreshRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery("UPDATE sessions").WillReturnError(sql.ErrNoRows)
+
+	requestBody := []byte(`{"refresh_token": "revoked"}`)
+	req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(requestBody))
+	w := httptest.NewRecorder()
+	srv.handleRefresh()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:unauthenticated",
+		"title": "Invalid or expired refresh token",
+		"status": 401,
+		"code": "unauthenticated"
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL")).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+// Tasks routes
+
+func TestTasksRequireAuth(t *testing.T) {
+	srv := NewServer()
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="todolist"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestTasksValidToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	mock.ExpectQuery(regexp.QuoteMeta(countTasks)).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE user_id = $1 ORDER BY id ASC LIMIT 101"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTasksInvalidToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("expired")).
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("Authorization", "Bearer expired")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+type jsonDependency struct {
+	BlockerID int64 `json:"blocker_id"`
+	TaskID    int64 `json:"task_id"`
+}
+
+type jsonDependencyGraph struct {
+	Tasks        []jsonTask       `json:"tasks"`
+	Dependencies []jsonDependency `json:"dependencies"`
+}
+
+// dependencyIDs reads the IDs of the blocked task and of its blocker from the
+// path. It writes the error response and returns false if they are not valid.
+func dependencyIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+		return 0, 0, false
+	}
+	blockerID, err := strconv.Atoi(vars["blocker_id"])
+	if err != nil {
+		middleware.NewHTTPError(w, r, "Invalid blocker ID", http.StatusBadRequest, err)
+		return 0, 0, false
+	}
+	return taskID, blockerID, true
+}
+
+// handleTaskBlocker adds or removes the dependency of a task on a blocker,
+// for PUT and DELETE /tasks/{id}/blockers/{blocker_id}
+func (s *server) handleTaskBlocker(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, blockerID, ok := dependencyIDs(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		var err error
+		if add {
+			err = s.DB.AddTaskDependency(r.Context(), userID, blockerID, taskID)
+		} else {
+			err = s.DB.RemoveTaskDependency(r.Context(), userID, blockerID, taskID)
+		}
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot change task blockers", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTaskDependencies writes the tasks blocking a task, directly or not,
+// and the tasks it blocks, with the dependencies between them
+func (s *server) handleTaskDependencies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		graph, err := s.DB.GetDependencyGraph(r.Context(), userID, taskID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load task dependencies", err)
+			return
+		}
+
+		resp := jsonDependencyGraph{
+			Tasks:        make([]jsonTask, len(graph.Tasks)),
+			Dependencies: make([]jsonDependency, len(graph.Dependencies)),
+		}
+		for i, t := range graph.Tasks {
+			resp.Tasks[i] = toJSONTask(t)
+		}
+		for i, d := range graph.Dependencies {
+			resp.Dependencies[i] = jsonDependency{BlockerID: d.BlockerID, TaskID: d.TaskID}
+		}
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTaskBlockerCycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(testUserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks")).WithArgs("{3,12}", testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("WITH RECURSIVE blocked").WithArgs(12, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("PUT", "/tasks/12/blockers/3", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12", "blocker_id": "3"})
+	w := httptest.NewRecorder()
+	srv.handleTaskBlocker(true)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "a task cannot block itself or one of its blockers")
+}
+
+func TestHandleTaskBlockerRemove(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM task_dependencies USING tasks")).WithArgs(3, 12, testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest("DELETE", "/tasks/12/blockers/3", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12", "blocker_id": "3"})
+	w := httptest.NewRecorder()
+	srv.handleTaskBlocker(false)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestHandleTaskCompleteBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(setTaskState)).WithArgs(true, 12, testUserID, 0).WillReturnRows(sqlmock.NewRows(taskChangeColumns))
+	mock.ExpectRollback()
+	mock.ExpectQuery(openBlockers).WithArgs(12, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	req := httptest.NewRequest("POST", "/tasks/12/complete", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskSetStateTo(true)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "task 12 is blocked by open tasks 3")
+}
+
+func TestHandleTaskDependencies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+selectedTaskColumns+" FROM tasks WHERE id = $1 AND user_id = $2")).WithArgs(12, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(12, "Deploy", false)...))
+	mock.ExpectQuery("WITH RECURSIVE blockers").WithArgs(12).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id", "task_id"}).AddRow(3, 12))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE id = ANY($1) AND user_id = $2 ORDER BY id")).WithArgs("{3}", testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(3, "Review", true)...))
+
+	req := httptest.NewRequest("GET", "/tasks/12/dependencies", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskDependencies()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"dependencies":[{"blocker_id":3,"task_id":12}]`)
+	assert.Contains(t, w.Body.String(), `"tasks":[{"id":12,`)
+}
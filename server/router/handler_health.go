@@ -0,0 +1,93 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Thybaau/todolist-app/logging"
+	"github.com/Thybaau/todolist-app/middleware"
+)
+
+// Maximum duration of the checks of a readiness probe
+const readinessTimeout = 2 * time.Second
+
+// Status of a probe or of one of its checks
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	// Migrations not applied yet, or a schema newer than the server
+	statusPending = "pending"
+	statusAhead   = "ahead"
+)
+
+type jsonHealth struct {
+	Status string               `json:"status"`
+	Checks map[string]jsonCheck `json:"checks,omitempty"`
+}
+
+type jsonCheck struct {
+	Status string `json:"status"`
+	// Generic reason of a failed check, its details are only logged
+	Error string `json:"error,omitempty"`
+	// Schema versions, for the migrations check
+	Version *int `json:"version,omitempty"`
+	Latest  *int `json:"latest,omitempty"`
+}
+
+// handleHealthz is the liveness probe : the process serves requests
+func (s *server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		middleware.JSONResponse(w, http.StatusOK, jsonHealth{Status: statusOK})
+	}
+}
+
+// handleReadyz is the readiness probe : the database answers and its schema
+// is migrated. It returns 503 when the server should not get traffic.
+func (s *server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		resp := jsonHealth{Status: statusOK, Checks: map[string]jsonCheck{}}
+		db := jsonCheck{Status: statusOK}
+		if err := s.DB.Ping(ctx); err != nil {
+			logging.FromContext(ctx).Error("Readiness check failed", "check", "database", "error", err.Error())
+			db = jsonCheck{Status: statusUnavailable, Error: "database unreachable"}
+		}
+		resp.Checks["database"] = db
+
+		migrations := jsonCheck{Status: statusUnavailable}
+		if db.Status == statusOK {
+			migrations = s.checkMigrations(ctx)
+		}
+		resp.Checks["migrations"] = migrations
+
+		// A newer schema is expected while a new release rolls out
+		status := http.StatusOK
+		if db.Status != statusOK || migrations.Status == statusUnavailable || migrations.Status == statusPending {
+			resp.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		middleware.JSONResponse(w, status, resp)
+	}
+}
+
+// checkMigrations compares the schema version to the embedded migrations
+func (s *server) checkMigrations(ctx context.Context) jsonCheck {
+	current, latest, err := s.DB.SchemaVersion(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Readiness check failed", "check", "migrations", "error", err.Error())
+		return jsonCheck{Status: statusUnavailable, Error: "cannot read the schema version"}
+	}
+	check := jsonCheck{Status: statusOK, Version: &current, Latest: &latest}
+	switch {
+	case current < latest:
+		check.Status = statusPending
+	case current > latest:
+		check.Status = statusAhead
+	}
+	return check
+}
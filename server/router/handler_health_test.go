@@ -0,0 +1,122 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	srv := NewServer()
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// expectSchemaVersion expects the queries of SchemaVersion
+func expectSchemaVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT to_regclass('schema_version') IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_version")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func latestMigration(t *testing.T) int {
+	migrator, err := database.NewMigrator(nil)
+	if err != nil {
+		t.Fatalf("Cannot load migrations : %s", err)
+	}
+	return migrator.Latest()
+}
+
+func TestHandleReadyz(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{DB: &database.DBStore{DB: db}}
+
+	latest := latestMigration(t)
+	mock.ExpectPing()
+	expectSchemaVersion(mock, latest)
+
+	w := httptest.NewRecorder()
+	srv.handleReadyz()(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	expectedResp := fmt.Sprintf(`{
+		"status": "ok",
+		"checks": {
+			"database": {"status": "ok"},
+			"migrations": {"status": "ok", "version": %d, "latest": %d}
+		}
+	  }`, latest, latest)
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleReadyzPendingMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{DB: &database.DBStore{DB: db}}
+
+	latest := latestMigration(t)
+	mock.ExpectPing()
+	expectSchemaVersion(mock, latest-1)
+
+	w := httptest.NewRecorder()
+	srv.handleReadyz()(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	expectedResp := fmt.Sprintf(`{
+		"status": "unavailable",
+		"checks": {
+			"database": {"status": "ok"},
+			"migrations": {"status": "pending", "version": %d, "latest": %d}
+		}
+	  }`, latest-1, latest)
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHandleReadyzDatabaseDown(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{DB: &database.DBStore{DB: db}}
+
+	mock.ExpectPing().WillReturnError(errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+
+	w := httptest.NewRecorder()
+	srv.handleReadyz()(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	expectedResp := `{
+		"status": "unavailable",
+		"checks": {
+			"database": {"status": "unavailable", "error": "database unreachable"},
+			"migrations": {"status": "unavailable"}
+		}
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	// Details of the failure are only logged
+	assert.NotContains(t, w.Body.String(), "10.0.0.5")
+}
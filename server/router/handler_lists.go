@@ -0,0 +1,203 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+// Maximum length of the name of a list, in characters
+const maxListNameLength = 100
+
+type jsonList struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	OpenTasks int64     `json:"open_tasks"`
+	DoneTasks int64     `json:"done_tasks"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toJSONList(l *database.List) jsonList {
+	return jsonList{
+		ID:        l.ID,
+		Name:      l.Name,
+		OpenTasks: l.OpenTasks,
+		DoneTasks: l.DoneTasks,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+	}
+}
+
+// decodeListRequest decodes and checks the body of a list request. It writes
+// the error response and returns false if the body is not valid.
+func decodeListRequest(w http.ResponseWriter, r *http.Request, decodeMessage string) (*database.List, bool) {
+	req := struct {
+		Name string `json:"name"`
+	}{}
+	if !middleware.DecodeJSON(w, r, &req, decodeMessage) {
+		return nil, false
+	}
+	req.Name = middleware.Trim(req.Name)
+	v := middleware.Validator{}
+	v.Required("name", req.Name)
+	v.MaxLength("name", req.Name, maxListNameLength)
+	v.SingleLine("name", req.Name)
+	if !v.Valid() {
+		middleware.NewValidationError(w, r, "List is not valid", v.Fields)
+		return nil, false
+	}
+	return &database.List{Name: req.Name}, true
+}
+
+// listID returns the list ID of the path of r. It writes the error response
+// and returns false if it is not valid.
+func listID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.NewHTTPError(w, r, "Invalid list ID", http.StatusBadRequest, err)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *server) handleLists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.UserID(r.Context())
+		lists, err := s.DB.GetLists(r.Context(), userID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load lists", err)
+			return
+		}
+		resp := make([]jsonList, len(lists))
+		for i, l := range lists {
+			resp[i] = toJSONList(l)
+		}
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
+
+func (s *server) handleListCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l, ok := decodeListRequest(w, r, "Cannot decode list body from json")
+		if !ok {
+			return
+		}
+
+		l.UserID, _ = middleware.UserID(r.Context())
+		if _, err := s.DB.CreateList(r.Context(), l); err != nil {
+			middleware.WriteError(w, r, "Cannot create list", err)
+			return
+		}
+		middleware.JSONResponse(w, http.StatusCreated, toJSONList(l))
+	}
+}
+
+func (s *server) handleListGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := listID(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		l, err := s.DB.GetList(r.Context(), userID, id)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load list", err)
+			return
+		}
+		middleware.JSONResponse(w, http.StatusOK, toJSONList(l))
+	}
+}
+
+// handleListEdit renames a list
+func (s *server) handleListEdit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l, ok := decodeListRequest(w, r, "Cannot parse list body")
+		if !ok {
+			return
+		}
+		id, ok := listID(w, r)
+		if !ok {
+			return
+		}
+
+		l.ID = int64(id)
+		l.UserID, _ = middleware.UserID(r.Context())
+		if err := s.DB.EditList(r.Context(), l); err != nil {
+			middleware.WriteError(w, r, "Cannot edit list", err)
+			return
+		}
+		middleware.JSONResponse(w, http.StatusOK, toJSONList(l))
+	}
+}
+
+// handleListDelete deletes a list with its tasks
+func (s *server) handleListDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := listID(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		if err := s.DB.DeleteList(r.Context(), userID, id); err != nil {
+			middleware.WriteError(w, r, "Cannot delete list", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleListTasks returns one page of the tasks of a list, with the query
+// parameters of GET /tasks
+func (s *server) handleListTasks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := listID(w, r)
+		if !ok {
+			return
+		}
+		q, err := parseTaskQuery(r.URL.Query())
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid query parameters", http.StatusBadRequest, err)
+			return
+		}
+
+		// An unknown list has no task, but is not found
+		userID, _ := middleware.UserID(r.Context())
+		l, err := s.DB.GetList(r.Context(), userID, id)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load list", err)
+			return
+		}
+		q.ListID = &l.ID
+		s.writeTaskPage(w, r, q)
+	}
+}
+
+// handleListTaskCreate creates a task in a list
+func (s *server) handleListTaskCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := decodeNewTaskRequest(w, r)
+		if !ok {
+			return
+		}
+		id, ok := listID(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		l, err := s.DB.GetList(r.Context(), userID, id)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load list", err)
+			return
+		}
+		t.ListID = &l.ID
+		s.createTask(w, r, t)
+	}
+}
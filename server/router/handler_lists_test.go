@@ -0,0 +1,206 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var listColumns = []string{"id", "user_id", "name", "created_at", "updated_at", "open_tasks", "done_tasks"}
+
+const selectList = "SELECT id, user_id, name, created_at, updated_at, " +
+	"(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND NOT tasks.state), " +
+	"(SELECT COUNT(*) FROM tasks WHERE tasks.list_id = lists.id AND tasks.state) FROM lists WHERE id = $1 AND user_id = $2"
+
+func TestHandleLists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM lists WHERE user_id = $1 ORDER BY id")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows(listColumns).AddRow(1, testUserID, "Sprint", testTime, testTime, 3, 2))
+
+	req := httptest.NewRequest("GET", "/lists", nil)
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleLists()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{
+		"id": 1,
+		"name": "Sprint",
+		"open_tasks": 3,
+		"done_tasks": 2,
+		"created_at": "2024-03-01T12:00:00Z",
+		"updated_at": "2024-03-01T12:00:00Z"
+	}]`, w.Body.String())
+}
+
+func TestHandleListCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO lists (user_id,name) VALUES ($1, $2)")).WithArgs(testUserID, "Backlog").
+		WillReturnRows(sqlmock.NewRows(listColumns).AddRow(2, testUserID, "Backlog", testTime, testTime, 0, 0))
+
+	req := httptest.NewRequest("POST", "/lists", bytes.NewBufferString(`{"name": "  Backlog "}`))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleListCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Backlog"`)
+}
+
+func TestHandleListCreateInvalid(t *testing.T) {
+	srv := &server{}
+	req := httptest.NewRequest("POST", "/lists", bytes.NewBufferString(`{"name": " "}`))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleListCreate()(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "List is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "name", "message": "Key 'name' cannot be empty"}]
+	}`, w.Body.String())
+}
+
+func TestHandleListDeleteNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM lists WHERE id = $1 AND user_id = $2")).WithArgs(4, testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	req := httptest.NewRequest("DELETE", "/lists/4", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "4"})
+	w := httptest.NewRecorder()
+	srv.handleListDelete()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleListTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectList)).WithArgs(1, testUserID).
+		WillReturnRows(sqlmock.NewRows(listColumns).AddRow(1, testUserID, "Sprint", testTime, testTime, 1, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND list_id = $2 AND state = $3")).
+		WithArgs(testUserID, 1, false).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	values := taskValues(5, "Task 5", false)
+	values[2] = 1
+	mock.ExpectQuery(regexp.QuoteMeta("FROM tasks WHERE user_id = $1 AND list_id = $2 AND state = $3 ORDER BY id ASC LIMIT 101")).
+		WithArgs(testUserID, 1, false).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+
+	req := httptest.NewRequest("GET", "/lists/1/tasks?state=false", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	srv.handleListTasks()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	assert.Contains(t, w.Body.String(), `"list_id":1`)
+}
+
+func TestHandleListTasksNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectList)).WithArgs(9, testUserID).
+		WillReturnRows(sqlmock.NewRows(listColumns))
+
+	req := httptest.NewRequest("POST", "/lists/9/tasks", bytes.NewBufferString(`{"content": "Task"}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "9"})
+	w := httptest.NewRecorder()
+	srv.handleListTaskCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleTaskPatchMoveOutOfList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET updated_at = now(), version = version + 1, list_id = $1 WHERE id = $2 AND user_id = $3")).
+		WithArgs(nil, 12, testUserID, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(taskChangeValues(12, "Task 1", false, false)...))
+
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{"list_id": null}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, taskJSON(12, "Task 1", false), w.Body.String())
+}
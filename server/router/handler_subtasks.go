@@ -0,0 +1,70 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+// A task with its subtasks, nested
+type jsonTaskTree struct {
+	jsonTask
+	Children []*jsonTaskTree `json:"children"`
+}
+
+// handleTaskTree writes a task with all its subtasks, nested
+func (s *server) handleTaskTree() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		tasks, err := s.DB.GetTaskTree(r.Context(), userID, taskID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load subtasks", err)
+			return
+		}
+
+		// Tasks come after their parent, the root first
+		nodes := make(map[int64]*jsonTaskTree, len(tasks))
+		for _, t := range tasks {
+			node := &jsonTaskTree{jsonTask: toJSONTask(t), Children: []*jsonTaskTree{}}
+			nodes[t.ID] = node
+			if t.ParentID != nil {
+				if parent, ok := nodes[*t.ParentID]; ok {
+					parent.Children = append(parent.Children, node)
+				}
+			}
+		}
+		middleware.JSONResponse(w, http.StatusOK, nodes[tasks[0].ID])
+	}
+}
+
+// handleSubtaskCreate creates a subtask, in the list of its parent
+func (s *server) handleSubtaskCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := decodeNewTaskRequest(w, r)
+		if !ok {
+			return
+		}
+		taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		parent, err := s.DB.GetTask(r.Context(), userID, taskID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load task", err)
+			return
+		}
+		t.ParentID, t.ListID = &parent.ID, parent.ListID
+		s.createTask(w, r, t)
+	}
+}
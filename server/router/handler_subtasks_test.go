@@ -0,0 +1,118 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTaskTree(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	root := taskValues(5, "Groceries", false)
+	root[15], root[16] = 1, 0
+	child := taskValues(12, "Dairy", false)
+	child[13], child[15], child[16] = 5, 1, 1
+	grandchild := taskValues(20, "Buy eggs", true)
+	grandchild[13] = 12
+	mock.ExpectQuery("WITH RECURSIVE tree").WithArgs(5, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(root...).AddRow(child...).AddRow(grandchild...))
+
+	req := httptest.NewRequest("GET", "/tasks/5/subtasks", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	w := httptest.NewRecorder()
+	srv.handleTaskTree()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":5,`)
+	assert.Contains(t, w.Body.String(), `"subtasks":{"total":1,"done":0},"recurrence":null,"children":[{"id":12,`)
+	assert.Contains(t, w.Body.String(), `"children":[{"id":20,`)
+	assert.Contains(t, w.Body.String(), `"parent_id":12,"auto_complete":false,"subtasks":{"total":0,"done":0},"recurrence":null,"children":[]}`)
+}
+
+func TestHandleTaskTreeNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery("WITH RECURSIVE tree").WithArgs(5, testUserID).WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	req := httptest.NewRequest("GET", "/tasks/5/subtasks", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	w := httptest.NewRecorder()
+	srv.handleTaskTree()(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleSubtaskCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	parent := taskValues(5, "Groceries", false)
+	parent[2] = 3
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+selectedTaskColumns+" FROM tasks WHERE id = $1 AND user_id = $2")).
+		WithArgs(5, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(parent...))
+	// The subtask is created in the list of its parent
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)")).
+		WithArgs(testUserID, int64(3), "Buy eggs", "", false, database.PriorityNone, nil, int64(5), true, "FREQ=WEEKLY").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(12, testTime, testTime, 1))
+
+	req := httptest.NewRequest("POST", "/tasks/5/subtasks", bytes.NewBufferString(`{"content": "Buy eggs", "auto_complete": true, "recurrence": "freq=weekly"}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	w := httptest.NewRecorder()
+	srv.handleSubtaskCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"list_id":3,`)
+	assert.Contains(t, w.Body.String(), `"parent_id":5,`)
+	assert.Contains(t, w.Body.String(), `"recurrence":"FREQ=WEEKLY"`)
+}
+
+func TestHandleTaskDeleteBadChildren(t *testing.T) {
+	srv := &server{}
+
+	req := httptest.NewRequest("DELETE", "/tasks/5?children=keep", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	w := httptest.NewRecorder()
+	srv.handleTaskDelete()(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "query parameter 'children' must be delete or promote")
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+// Tags are words of letters, digits, '_' or '-'
+var validTag = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,50}$`)
+
+type jsonTag struct {
+	Name  string `json:"name"`
+	Tasks int64  `json:"tasks"`
+}
+
+// parseTag normalizes the name of a tag : tags are lower case, and a leading
+// '#' is ignored
+func parseTag(name string) (string, error) {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tag %q must be 1 to 50 letters, digits, '_' or '-'", name)
+	}
+	return tag, nil
+}
+
+func (s *server) handleTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.UserID(r.Context())
+		tags, err := s.DB.GetTags(r.Context(), userID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load tags", err)
+			return
+		}
+		resp := make([]jsonTag, len(tags))
+		for i, t := range tags {
+			resp[i] = jsonTag{Name: t.Name, Tasks: t.Tasks}
+		}
+		middleware.JSONResponse(w, http.StatusOK, resp)
+	}
+}
+
+// handleTaskTag adds the tag of the path to a task, or removes it if add
+// is false, and writes the task
+func (s *server) handleTaskTag(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract task ID and tag
+		vars := mux.Vars(r)
+		taskID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+		tag, err := parseTag(vars["tag"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid tag", http.StatusBadRequest, err)
+			return
+		}
+
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			preconditionFailed(w, r)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		var task *database.Task
+		if add {
+			task, err = s.DB.AddTaskTag(r.Context(), userID, taskID, version, tag)
+		} else {
+			task, err = s.DB.RemoveTaskTag(r.Context(), userID, taskID, version, tag)
+		}
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot change task tags", err)
+			return
+		}
+
+		// Write response
+		writeTask(w, http.StatusOK, task)
+	}
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTaskTagAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	values := taskValues(12, "Fix login", false)
+	values[11], values[12] = 2, "{bug}"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(12, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tags (user_id,name)")).WithArgs(testUserID, "bug").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO task_tags (task_id,tag_id)")).WithArgs(12, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET updated_at = now(), version = version + 1 WHERE id = $1")).WithArgs(12).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("PUT", "/tasks/12/tags/%23Bug", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12", "tag": "#Bug"})
+	w := httptest.NewRecorder()
+	srv.handleTaskTag(true)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"tags":["bug"]`)
+}
+
+func TestHandleTaskTagPreconditionFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM tasks WHERE id = $1 AND user_id = $2 FOR UPDATE")).WithArgs(12, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(6))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("DELETE", "/tasks/12/tags/bug", nil)
+	req.Header.Set("If-Match", `"5"`)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12", "tag": "bug"})
+	w := httptest.NewRecorder()
+	srv.handleTaskTag(false)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestHandleTaskTagInvalid(t *testing.T) {
+	srv := &server{}
+	req := httptest.NewRequest("DELETE", "/tasks/12/tags/a.b", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12", "tag": "a.b"})
+	w := httptest.NewRecorder()
+	srv.handleTaskTag(false)(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"Invalid tag"`)
+}
+
+func TestParseTaskQueryTags(t *testing.T) {
+	q, err := parseTaskQuery(url.Values{"tag": {"Home", "#urgent"}, "tag_mode": {"any"}})
+	if err != nil {
+		t.Fatalf("Error while parsing query : %s", err)
+	}
+	assert.Equal(t, []string{"home", "urgent"}, q.Tags)
+	assert.True(t, q.AnyTag)
+}
@@ -1,103 +1,428 @@
 package router
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Thybaau/todolist-app/database"
 	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/Thybaau/todolist-app/recurrence"
 	"github.com/gorilla/mux"
 )
 
+// Maximum lengths of the text fields of a task, in characters
+const (
+	maxContentLength     = 500
+	maxDescriptionLength = 10000
+)
+
 type jsonTask struct {
-	ID      int64  `json:"id"`
-	Content string `json:"content"`
-	State   bool   `json:"state"`
+	ID          int64      `json:"id"`
+	ListID      *int64     `json:"list_id"`
+	Content     string     `json:"content"`
+	Description string     `json:"description"`
+	State       bool       `json:"state"`
+	Priority    string     `json:"priority"`
+	Tags        []string   `json:"tags"`
+	DueAt       *time.Time `json:"due_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Version     int64      `json:"version"`
+	// Subtasks
+	ParentID     *int64       `json:"parent_id"`
+	AutoComplete bool         `json:"auto_complete"`
+	Subtasks     jsonSubtasks `json:"subtasks"`
+	// Recurrence rule, null for tasks which do not recur
+	Recurrence *string `json:"recurrence"`
+}
+
+// Completion rollup of the direct subtasks of a task
+type jsonSubtasks struct {
+	Total int64 `json:"total"`
+	Done  int64 `json:"done"`
+}
+
+func toJSONTask(t *database.Task) jsonTask {
+	tags := t.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	var rule *string
+	if t.Recurrence != "" {
+		rule = &t.Recurrence
+	}
+	return jsonTask{
+		ID:           t.ID,
+		ListID:       t.ListID,
+		Content:      t.Content,
+		Description:  t.Description,
+		State:        t.State,
+		Priority:     t.Priority.String(),
+		Tags:         tags,
+		DueAt:        t.DueAt,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.UpdatedAt,
+		CompletedAt:  t.CompletedAt,
+		Version:      t.Version,
+		ParentID:     t.ParentID,
+		AutoComplete: t.AutoComplete,
+		Subtasks:     jsonSubtasks{Total: t.Subtasks, Done: t.DoneSubtasks},
+		Recurrence:   rule,
+	}
+}
+
+// writeTask writes a task response, with the version of the task as ETag
+func writeTask(w http.ResponseWriter, status int, t *database.Task) {
+	w.Header().Set("ETag", taskETag(t.Version))
+	middleware.JSONResponse(w, status, toJSONTask(t))
+}
+
+func taskETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion returns the version of the task required by the If-Match
+// header of r, or 0 if any version matches. It returns false if no version
+// can match, only a single strong ETag being supported.
+func ifMatchVersion(r *http.Request) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// preconditionFailed writes the response of requests whose If-Match header
+// cannot match any version of the task
+func preconditionFailed(w http.ResponseWriter, r *http.Request) {
+	middleware.NewHTTPError(w, r, "If-Match must be a single strong ETag", http.StatusPreconditionFailed, nil)
+}
+
+// validateTaskFields trims and checks the editable fields of a task, nil
+// fields are not checked. It returns the parsed priority and the list of
+// invalid fields.
+func validateTaskFields(content, description, priority *string) (database.Priority, []middleware.FieldError) {
+	v := middleware.Validator{}
+	if content != nil {
+		*content = middleware.Trim(*content)
+		v.Required("content", *content)
+		v.MaxLength("content", *content, maxContentLength)
+		v.SingleLine("content", *content)
+	}
+	if description != nil {
+		*description = middleware.Trim(*description)
+		v.MaxLength("description", *description, maxDescriptionLength)
+		v.MultiLine("description", *description)
+	}
+	var parsed database.Priority
+	if priority != nil {
+		var err error
+		parsed, err = database.ParsePriority(*priority)
+		v.Check(err == nil, "priority", "Key 'priority' must be none, low, medium or high")
+	}
+	return parsed, v.Fields
+}
+
+// checkRecurrence checks a recurrence rule and puts it in canonical form, an
+// empty rule meaning the task does not recur. The rule must have occurrences
+// after dueAt when not nil.
+func checkRecurrence(v *middleware.Validator, rule *string, dueAt *time.Time) {
+	*rule = strings.TrimSpace(*rule)
+	if *rule == "" {
+		return
+	}
+	parsed, err := recurrence.Parse(*rule)
+	if err != nil {
+		v.Check(false, "recurrence", fmt.Sprintf("Key 'recurrence' is not a valid rule : %s", err))
+		return
+	}
+	if dueAt != nil {
+		if err := parsed.CheckFrom(*dueAt); err != nil {
+			v.Check(false, "recurrence", fmt.Sprintf("Key 'recurrence' never recurs from 'due_at' : %s", err))
+			return
+		}
+	}
+	*rule = parsed.String()
+}
+
+// Editable fields of a task, sent to create and edit it
+type taskRequest struct {
+	Content     string     `json:"content"`
+	Description string     `json:"description"`
+	Priority    string     `json:"priority"`
+	DueAt       *time.Time `json:"due_at"`
+}
+
+// decodeTaskRequest decodes and checks the body of a task request. It writes
+// the error response and returns false if the body is not valid.
+func decodeTaskRequest(w http.ResponseWriter, r *http.Request, decodeMessage string) (*database.Task, bool) {
+	req := taskRequest{}
+	if !middleware.DecodeJSON(w, r, &req, decodeMessage) {
+		return nil, false
+	}
+	return checkTaskRequest(w, r, req, &middleware.Validator{})
+}
+
+// checkTaskRequest checks the fields of a decoded task request, along with
+// the other fields of the request already checked by v. It writes the error
+// response listing all of them and returns false if any is not valid.
+func checkTaskRequest(w http.ResponseWriter, r *http.Request, req taskRequest, v *middleware.Validator) (*database.Task, bool) {
+	priority, fields := validateTaskFields(&req.Content, &req.Description, &req.Priority)
+	v.Fields = append(fields, v.Fields...)
+	if !v.Valid() {
+		middleware.NewValidationError(w, r, "Task is not valid", v.Fields)
+		return nil, false
+	}
+
+	return &database.Task{
+		Content:     req.Content,
+		Description: req.Description,
+		Priority:    priority,
+		DueAt:       req.DueAt,
+	}, true
+}
+
+// Fields of a new task, sent to every route creating one
+type newTaskRequest struct {
+	taskRequest
+	AutoComplete bool `json:"auto_complete"`
+	// Recurrence rule such as FREQ=WEEKLY;BYDAY=MO, none if empty
+	Recurrence string `json:"recurrence"`
+}
+
+// decodeNewTaskRequest decodes and checks the body of a request creating a
+// task in a list or under a parent given by its route. It writes the error
+// response and returns false if the body is not valid.
+func decodeNewTaskRequest(w http.ResponseWriter, r *http.Request) (*database.Task, bool) {
+	req := newTaskRequest{}
+	if !middleware.DecodeJSON(w, r, &req, "Cannot decode task body from json") {
+		return nil, false
+	}
+	return checkNewTaskRequest(w, r, req)
+}
+
+// checkNewTaskRequest checks the fields of a decoded new task. It writes the
+// error response and returns false if they are not valid.
+func checkNewTaskRequest(w http.ResponseWriter, r *http.Request, req newTaskRequest) (*database.Task, bool) {
+	v := middleware.Validator{}
+	checkRecurrence(&v, &req.Recurrence, req.DueAt)
+	t, ok := checkTaskRequest(w, r, req.taskRequest, &v)
+	if !ok {
+		return nil, false
+	}
+	t.AutoComplete, t.Recurrence = req.AutoComplete, req.Recurrence
+	return t, true
 }
 
 func (s *server) handleTaskCreate() http.HandlerFunc {
 	type request struct {
-		Content string `json:"content"`
+		newTaskRequest
+		// List of the task, none if nil
+		ListID *int64 `json:"list_id"`
+		// Parent of the task, top level if nil
+		ParentID *int64 `json:"parent_id"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Decode and check fields in request
 		req := request{}
-		err := json.NewDecoder(r.Body).Decode(&req)
-		if err != nil {
-			middleware.NewHTTPError(w, "Cannot decode task body from json", http.StatusBadRequest, err)
+		if !middleware.DecodeJSON(w, r, &req, "Cannot decode task body from json") {
 			return
 		}
-		if req.Content == "" {
-			middleware.NewHTTPError(w, "Key 'content' cannot be empty", http.StatusForbidden, nil)
+		t, ok := checkNewTaskRequest(w, r, req.newTaskRequest)
+		if !ok {
 			return
 		}
+		t.ListID, t.ParentID = req.ListID, req.ParentID
+		s.createTask(w, r, t)
+	}
+}
+
+// createTask inserts t for the authenticated user and writes the response
+func (s *server) createTask(w http.ResponseWriter, r *http.Request, t *database.Task) {
+	// Insert task in database
+	t.UserID, _ = middleware.UserID(r.Context())
+	_, err := s.DB.CreateTask(r.Context(), t)
+	if err != nil {
+		middleware.WriteError(w, r, "Cannot create task in database", err)
+		return
+	}
+	s.Metrics.TaskCreated()
+
+	// Write response
+	writeTask(w, http.StatusOK, t)
+}
+
+// Query parameters accepted by GET /tasks, besides 'id'
+var taskListParams = map[string]bool{
+	"state": true, "q": true, "tag": true, "tag_mode": true, "parent_id": true,
+	"sort": true, "order": true, "limit": true, "cursor": true,
+}
+
+// parseTaskQuery reads the filters, sort and pagination of a task list
+func parseTaskQuery(params url.Values) (database.TaskQuery, error) {
+	q := database.TaskQuery{}
+	for key := range params {
+		if !taskListParams[key] {
+			return q, fmt.Errorf("unknown query parameter '%s'", key)
+		}
+	}
 
-		// Insert task in database
-		t := &database.Task{
-			ID:      0, //Useless because we will not use this element
-			Content: req.Content,
-			State:   false,
+	if state := params.Get("state"); state != "" {
+		b, err := strconv.ParseBool(state)
+		if err != nil {
+			return q, fmt.Errorf("query parameter 'state' must be true or false")
 		}
-		id, err := s.DB.CreateTask(t)
+		q.State = &b
+	}
+	q.Search = params.Get("q")
+	for _, name := range params["tag"] {
+		tag, err := parseTag(name)
 		if err != nil {
-			middleware.NewHTTPError(w, "Cannot create task in database", http.StatusBadRequest, err)
-			return
+			return q, fmt.Errorf("query parameter 'tag': %w", err)
 		}
-
-		// Write response
-		var resp = jsonTask{
-			ID:      id,
-			Content: t.Content,
-			State:   t.State,
+		q.Tags = append(q.Tags, tag)
+	}
+	switch params.Get("tag_mode") {
+	case "", "all":
+	case "any":
+		q.AnyTag = true
+	default:
+		return q, fmt.Errorf("query parameter 'tag_mode' must be all or any")
+	}
+	switch parent := params.Get("parent_id"); parent {
+	case "":
+	case "none":
+		q.TopLevel = true
+	default:
+		id, err := strconv.ParseInt(parent, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("query parameter 'parent_id' must be a task ID or none")
+		}
+		q.ParentID = &id
+	}
+	if sort := params.Get("sort"); sort != "" {
+		valid := false
+		for _, field := range database.TaskSortFields() {
+			valid = valid || sort == field
+		}
+		if !valid {
+			return q, fmt.Errorf("query parameter 'sort' must be one of %s", strings.Join(database.TaskSortFields(), ", "))
 		}
-		middleware.JSONResponse(w, http.StatusOK, resp)
+		q.Sort = sort
 	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("query parameter 'order' must be asc or desc")
+	}
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > database.MaxTaskLimit {
+			return q, fmt.Errorf("query parameter 'limit' must be between 1 and %d", database.MaxTaskLimit)
+		}
+		q.Limit = l
+	}
+	q.Cursor = params.Get("cursor")
+	return q, nil
 }
 
 func (s *server) handleTaskList() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var resp interface{}
+		userID, _ := middleware.UserID(r.Context())
 		queryParams := r.URL.Query()
 
-		// If we did not put any query parameter, we get all the task list
-		if len(queryParams) == 0 {
-			tasks, err := s.DB.GetTaskList()
-			if err != nil {
-				middleware.NewHTTPError(w, "Cannot load tasks", http.StatusInternalServerError, err)
-			}
-			resp = make([]jsonTask, len(tasks))
-			for i, t := range tasks {
-				resp.([]jsonTask)[i] = jsonTask{
-					ID:      t.ID,
-					Content: t.Content,
-					State:   t.State,
-				}
-			}
-			// If we put query parameter 'id', we get task with this id
-		} else {
+		// If we put query parameter 'id', we get task with this id.
+		// Deprecated in favor of GET /tasks/{id}
+		if _, ok := queryParams["id"]; ok {
 			taskID := queryParams.Get("id")
 			if taskID == "" {
-				middleware.NewHTTPError(w, "Query parameter 'id' not found", http.StatusNotFound, nil)
+				middleware.NewHTTPError(w, r, "Query parameter 'id' not found", http.StatusNotFound, nil)
 				return
 			}
+			middleware.Deprecated(w, APIPrefix+"/tasks/"+taskID)
 			ID, _ := strconv.Atoi(taskID)
-			task, err := s.DB.GetTask(ID)
+			task, err := s.DB.GetTask(r.Context(), userID, ID)
 			if err != nil {
-				message := fmt.Sprintf("Task id=%v not found", taskID)
-				middleware.NewHTTPError(w, message, http.StatusNotFound, err)
+				middleware.WriteError(w, r, "Cannot load task", err)
 				return
 			}
-			resp = jsonTask{
-				ID:      task.ID,
-				Content: task.Content,
-				State:   task.State,
-			}
+			writeTask(w, http.StatusOK, task)
+			return
+		}
+
+		// Otherwise we get one page of the task list
+		q, err := parseTaskQuery(queryParams)
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid query parameters", http.StatusBadRequest, err)
+			return
+		}
+		s.writeTaskPage(w, r, q)
+	}
+}
+
+// writeTaskPage writes the page of the tasks of the authenticated user
+// selected by q, with its pagination metadata
+func (s *server) writeTaskPage(w http.ResponseWriter, r *http.Request, q database.TaskQuery) {
+	userID, _ := middleware.UserID(r.Context())
+	page, err := s.DB.GetTaskList(r.Context(), userID, q)
+	if err != nil {
+		middleware.WriteError(w, r, "Cannot load tasks", err)
+		return
+	}
+	resp := make([]jsonTask, len(page.Tasks))
+	for i, t := range page.Tasks {
+		resp[i] = toJSONTask(t)
+	}
+
+	// Pagination metadata
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		next := *r.URL
+		params := next.Query()
+		params.Set("cursor", page.NextCursor)
+		next.RawQuery = params.Encode()
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+
+	// Write response
+	middleware.JSONResponse(w, http.StatusOK, resp)
+}
+
+func (s *server) handleTaskGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract request ID
+		vars := mux.Vars(r)
+		taskID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		task, err := s.DB.GetTask(r.Context(), userID, taskID)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot load task", err)
+			return
 		}
+
 		// Write response
-		middleware.JSONResponse(w, http.StatusOK, resp)
+		writeTask(w, http.StatusOK, task)
 	}
 }
 
@@ -107,14 +432,33 @@ func (s *server) handleTaskDelete() http.HandlerFunc {
 		vars := mux.Vars(r)
 		taskID, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			middleware.NewHTTPError(w, "Invalid task ID", http.StatusBadRequest, err)
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			preconditionFailed(w, r)
+			return
+		}
+
+		// Subtasks are deleted with the task unless promoted to its parent
+		var promote bool
+		switch r.URL.Query().Get("children") {
+		case "", "delete":
+		case "promote":
+			promote = true
+		default:
+			err := fmt.Errorf("query parameter 'children' must be delete or promote")
+			middleware.NewHTTPError(w, r, "Invalid query parameters", http.StatusBadRequest, err)
 			return
 		}
 
 		//Delete Task
-		err = s.DB.DeleteTask(taskID)
+		userID, _ := middleware.UserID(r.Context())
+		err = s.DB.DeleteTask(r.Context(), userID, taskID, version, promote)
 		if err != nil {
-			middleware.NewHTTPError(w, "Cannot delete task", http.StatusBadRequest, err)
+			middleware.WriteError(w, r, "Cannot delete task", err)
 			return
 		}
 
@@ -126,20 +470,123 @@ func (s *server) handleTaskDelete() http.HandlerFunc {
 }
 
 func (s *server) handleTaskEdit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Decode and validate fields in the request
+		t, ok := decodeTaskRequest(w, r, "Cannot parse task body")
+		if !ok {
+			return
+		}
+
+		// Extract ID from path parameter
+		vars := mux.Vars(r)
+		taskID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			middleware.NewHTTPError(w, r, "Invalid ID", http.StatusBadRequest, err)
+			return
+		}
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			preconditionFailed(w, r)
+			return
+		}
+
+		userID, _ := middleware.UserID(r.Context())
+		t.ID, t.UserID, t.Version = int64(taskID), userID, version
+		err = s.DB.EditTask(r.Context(), t)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot edit task", err)
+			return
+		}
+
+		// Write response
+		writeTask(w, http.StatusOK, t)
+	}
+}
+
+// optionalTime tells apart a missing JSON key from an explicit null
+type optionalTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (o *optionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// optionalID tells apart a missing JSON key from an explicit null
+type optionalID struct {
+	Set   bool
+	Value *int64
+}
+
+func (o *optionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// optionalString tells apart a missing JSON key from an explicit null
+type optionalString struct {
+	Set   bool
+	Value *string
+}
+
+func (o *optionalString) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (s *server) handleTaskPatch() http.HandlerFunc {
 	type request struct {
-		Content string `json:"content"`
+		Content      *string      `json:"content"`
+		Description  *string      `json:"description"`
+		Priority     *string      `json:"priority"`
+		State        *bool        `json:"state"`
+		DueAt        optionalTime `json:"due_at"`
+		ListID       optionalID   `json:"list_id"`
+		ParentID     optionalID   `json:"parent_id"`
+		AutoComplete *bool        `json:"auto_complete"`
+
+		// Null or empty to stop the recurrence
+		Recurrence optionalString `json:"recurrence"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Decode RequestBody
+		// Decode and validate fields in the request, missing fields are not changed
 		req := request{}
-		err := json.NewDecoder(r.Body).Decode(&req)
-		if err != nil {
-			middleware.NewHTTPError(w, "Cannot parse task body", http.StatusBadRequest, err)
+		if !middleware.DecodeJSON(w, r, &req, "Cannot parse task body") {
+			return
+		}
+		patch := database.TaskPatch{
+			Content:      req.Content,
+			Description:  req.Description,
+			State:        req.State,
+			SetDueAt:     req.DueAt.Set,
+			DueAt:        req.DueAt.Value,
+			SetListID:    req.ListID.Set,
+			ListID:       req.ListID.Value,
+			SetParentID:  req.ParentID.Set,
+			ParentID:     req.ParentID.Value,
+			AutoComplete: req.AutoComplete,
+		}
+		priority, fields := validateTaskFields(req.Content, req.Description, req.Priority)
+		if req.Recurrence.Set {
+			rule := ""
+			if req.Recurrence.Value != nil {
+				rule = *req.Recurrence.Value
+			}
+			v := middleware.Validator{Fields: fields}
+			checkRecurrence(&v, &rule, req.DueAt.Value)
+			fields, patch.Recurrence = v.Fields, &rule
+		}
+		if len(fields) > 0 {
+			middleware.NewValidationError(w, r, "Task is not valid", fields)
 			return
 		}
-		//Valide fields in the request
-		if req.Content == "" {
-			middleware.NewHTTPError(w, "Key 'content' cannot be empty", http.StatusForbidden, nil)
+		if req.Priority != nil {
+			patch.Priority = &priority
+		}
+		if patch.Empty() {
+			middleware.NewHTTPError(w, r, "Request body has no field to update", http.StatusBadRequest, nil)
 			return
 		}
 
@@ -147,59 +594,126 @@ func (s *server) handleTaskEdit() http.HandlerFunc {
 		vars := mux.Vars(r)
 		taskID, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			middleware.NewHTTPError(w, "Invalid ID", http.StatusBadRequest, err)
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+			return
+		}
+
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			preconditionFailed(w, r)
 			return
 		}
-		err = s.DB.EditTask(taskID, req.Content)
+		patch.Version = version
+
+		userID, _ := middleware.UserID(r.Context())
+		task, err := s.DB.UpdateTask(r.Context(), userID, taskID, patch)
 		if err != nil {
-			middleware.NewHTTPError(w, "Cannot edit task", http.StatusBadRequest, err)
+			middleware.WriteError(w, r, "Cannot update task", err)
 			return
 		}
+		s.countStateChange(task)
 
 		// Write response
-		task, err := s.DB.GetTask(taskID)
-		if err != nil {
-			message := fmt.Sprintf("Cannot get task informations for id=%v", taskID)
-			middleware.NewHTTPError(w, message, http.StatusBadRequest, err)
+		writeTask(w, http.StatusOK, task)
+	}
+}
+
+// handleTaskSetState sets the state given in the body of the request
+func (s *server) handleTaskSetState() http.HandlerFunc {
+	type request struct {
+		State *bool `json:"state"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if !middleware.DecodeJSON(w, r, &req, "Cannot parse state body") {
 			return
 		}
-		var resp = jsonTask{
-			ID:      task.ID,
-			Content: task.Content,
-			State:   task.State,
+		v := middleware.Validator{}
+		v.Check(req.State != nil, "state", "Key 'state' is required")
+		if !v.Valid() {
+			middleware.NewValidationError(w, r, "State is not valid", v.Fields)
+			return
 		}
-		middleware.JSONResponse(w, http.StatusOK, resp)
+		s.setTaskState(w, r, *req.State)
+	}
+}
+
+// handleTaskSetStateTo sets the given state, for POST /tasks/{id}/complete
+// and /tasks/{id}/reopen
+func (s *server) handleTaskSetStateTo(state bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.setTaskState(w, r, state)
+	}
+}
+
+// countStateChange counts the tasks completed by a change of state, with
+// the parents it auto completed, and the next occurrences it created
+func (s *server) countStateChange(t *database.Task) {
+	if t.JustCompleted {
+		s.Metrics.TaskCompleted()
+	}
+	for i := 0; i < t.CompletedParents; i++ {
+		s.Metrics.TaskCompleted()
+	}
+	for i := 0; i < t.CreatedOccurrences; i++ {
+		s.Metrics.TaskCreated()
+	}
+}
+
+func (s *server) setTaskState(w http.ResponseWriter, r *http.Request, state bool) {
+	// Extract request ID
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
+		return
+	}
+
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		preconditionFailed(w, r)
+		return
 	}
+
+	userID, _ := middleware.UserID(r.Context())
+	task, err := s.DB.SetTaskState(r.Context(), userID, taskID, version, state)
+	if err != nil {
+		middleware.WriteError(w, r, "Cannot change task state", err)
+		return
+	}
+	s.countStateChange(task)
+
+	// Write response
+	writeTask(w, http.StatusOK, task)
 }
 
+// Deprecated in favor of PUT /tasks/{id}/state with {"state": ...}
 func (s *server) handleTaskState() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract request ID
 		vars := mux.Vars(r)
 		taskID, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			middleware.NewHTTPError(w, "Invalid task ID", http.StatusBadRequest, err)
+			middleware.NewHTTPError(w, r, "Invalid task ID", http.StatusBadRequest, err)
 			return
 		}
+		middleware.Deprecated(w, APIPrefix+"/tasks/"+vars["id"]+"/state")
 
-		task, err := s.DB.ChangeTaskState(taskID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				middleware.NewHTTPError(w, "Task not found", http.StatusNotFound, err)
-				return
-			} else {
-				middleware.NewHTTPError(w, "Cannot change task state", http.StatusBadRequest, err)
-				return
-			}
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			preconditionFailed(w, r)
+			return
 		}
 
-		// Write response
-		var resp = jsonTask{
-			ID:      task.ID,
-			Content: task.Content,
-			State:   task.State,
+		userID, _ := middleware.UserID(r.Context())
+		task, err := s.DB.ChangeTaskState(r.Context(), userID, taskID, version)
+		if err != nil {
+			middleware.WriteError(w, r, "Cannot change task state", err)
+			return
 		}
-		middleware.JSONResponse(w, http.StatusOK, resp)
+		s.countStateChange(task)
 
+		// Write response
+		writeTask(w, http.StatusOK, task)
 	}
 }
@@ -3,18 +3,91 @@ package router
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/auth"
 	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/middleware"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
+// ID of the user authenticated in every test request
+const testUserID = 7
+
+func withUser(req *http.Request) *http.Request {
+	principal := &middleware.Principal{UserID: testUserID, SessionID: 1, Scope: auth.ScopeReadWrite}
+	return req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+}
+
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// Columns selected by the queries returning tasks
+const selectedTaskColumns = "id, user_id, list_id, content, description, state, priority, due_at, created_at, updated_at, completed_at, version, " +
+	"ARRAY(SELECT tags.name FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE task_tags.task_id = tasks.id ORDER BY tags.name), parent_id, auto_complete, " +
+	"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id), " +
+	"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.state), recurrence"
+
+// Condition of the queries completing a task on its blockers
+const notBlocked = "NOT EXISTS (SELECT 1 FROM task_dependencies JOIN tasks AS blockers ON blockers.id = task_dependencies.blocker_id " +
+	"WHERE task_dependencies.task_id = tasks.id AND NOT blockers.state)"
+
+var taskColumns = []string{"id", "user_id", "list_id", "content", "description", "state", "priority", "due_at", "created_at", "updated_at", "completed_at", "version", "tags",
+	"parent_id", "auto_complete", "subtasks", "done_subtasks", "recurrence"}
+
+// taskValues returns a task row of the test user without any details
+func taskValues(id int, content string, state bool) []driver.Value {
+	var completedAt interface{}
+	if state {
+		completedAt = testTime
+	}
+	return []driver.Value{id, testUserID, nil, content, "", state, 0, nil, testTime, testTime, completedAt, 1, "{}", nil, false, 0, 0, ""}
+}
+
+// Columns returned when changing the state of a task
+var taskChangeColumns = append(taskColumns[:len(taskColumns):len(taskColumns)], "completed_now")
+
+// taskChangeValues returns a row of taskChangeColumns
+func taskChangeValues(id int, content string, state, completedNow bool) []driver.Value {
+	return append(taskValues(id, content, state), completedNow)
+}
+
+// taskJSON returns the response for a task returned by taskValues
+func taskJSON(id int, content string, state bool) string {
+	completedAt := "null"
+	if state {
+		completedAt = `"2024-03-01T12:00:00Z"`
+	}
+	return fmt.Sprintf(`{
+		"id": %d,
+		"list_id": null,
+		"content": %q,
+		"description": "",
+		"state": %t,
+		"priority": "none",
+		"tags": [],
+		"due_at": null,
+		"created_at": "2024-03-01T12:00:00Z",
+		"updated_at": "2024-03-01T12:00:00Z",
+		"completed_at": %s,
+		"version": 1,
+		"parent_id": null,
+		"auto_complete": false,
+		"subtasks": {"total": 0, "done": 0},
+		"recurrence": null
+	  }`, id, content, state, completedAt)
+}
+
+const countTasks = "SELECT COUNT(*) FROM tasks WHERE user_id = $1"
+
 // Task list
 
 func TestHandleTaskList(t *testing.T) {
@@ -23,15 +96,19 @@ func TestHandleTaskList(t *testing.T) {
 		t.Fatalf("Error while creating mock : %s", err)
 	}
 	defer db.Close()
-	rows := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(1, "Task 1", false).
-		AddRow(2, "Task 2", false)
-
-	mock.ExpectQuery("SELECT id, content, state FROM tasks").WillReturnRows(rows)
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(1, "Task 1", false)...).
+		AddRow(taskValues(2, "Task 2", false)...)
+
+	mock.ExpectQuery(regexp.QuoteMeta(countTasks)).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE user_id = $1 ORDER BY id ASC LIMIT 101"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(testUserID).WillReturnRows(rows)
 	srv := &server{
 		DB: &database.DBStore{DB: db},
 	}
 	req := httptest.NewRequest("GET", "/tasks", nil)
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskList()(w, req)
 
@@ -39,20 +116,68 @@ func TestHandleTaskList(t *testing.T) {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 
-	expectedResp := `[
-		{
-		  "id": 1,
-		  "content": "Task 1",
-		  "state": false
-		},
-		{
-		  "id": 2,
-		  "content": "Task 2",
-		  "state": false
-		}
-	  ]`
+	expectedResp := "[" + taskJSON(1, "Task 1", false) + "," + taskJSON(2, "Task 2", false) + "]"
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+}
+
+func TestHandleTaskListFiltered(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(4, "Buy milk", false)...).
+		AddRow(taskValues(2, "Buy bread", false)...)
+
+	count := "SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND state = $2 AND (content ILIKE $3 OR description ILIKE $3)"
+	mock.ExpectQuery(regexp.QuoteMeta(count)).WithArgs(testUserID, false, "%buy%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	query := "FROM tasks WHERE user_id = $1 AND state = $2 AND (content ILIKE $3 OR description ILIKE $3) ORDER BY created_at DESC, id DESC LIMIT 2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(testUserID, false, "%buy%").WillReturnRows(rows)
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+	req := httptest.NewRequest("GET", "/tasks?state=false&q=buy&sort=created_at&order=desc&limit=1", nil)
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskList()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+
+	assert.JSONEq(t, "["+taskJSON(4, "Buy milk", false)+"]", w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+	cursor := w.Header().Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor)
+	assert.Contains(t, w.Header().Get("Link"), "cursor="+cursor)
+}
+
+func TestHandleTaskListBadParameter(t *testing.T) {
+	srv := &server{}
+	for query, detail := range map[string]string{
+		"/tasks?state=maybe":  "query parameter 'state' must be true or false",
+		"/tasks?sort=owner":   "query parameter 'sort' must be one of id, content, priority, created_at, updated_at, due_at",
+		"/tasks?order=random": "query parameter 'order' must be asc or desc",
+		"/tasks?limit=0":      "query parameter 'limit' must be between 1 and 500",
+		"/tasks?page=2":       "unknown query parameter 'page'",
+		"/tasks?tag=a%20b":    `query parameter 'tag': tag "a b" must be 1 to 50 letters, digits, '_' or '-'`,
+		"/tasks?tag_mode=one": "query parameter 'tag_mode' must be all or any",
+	} {
+		req := httptest.NewRequest("GET", query, nil)
+		req = withUser(req)
+		w := httptest.NewRecorder()
+		srv.handleTaskList()(w, req)
+
+		expectedResp := fmt.Sprintf(`{"type": "urn:todolist:problem:bad_request", "title": "Invalid query parameters", "status": 400, "code": "bad_request", "detail": %q}`, detail)
+		assert.JSONEq(t, expectedResp, w.Body.String(), query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
 }
 
 func TestHandleTaskListOneTask(t *testing.T) {
@@ -61,15 +186,16 @@ func TestHandleTaskListOneTask(t *testing.T) {
 		t.Fatalf("Error while creating mock : %s", err)
 	}
 	defer db.Close()
-	rows := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(2, "Task 2", false)
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(2, "Task 2", false)...)
 
-	query := "SELECT id, content, state FROM tasks WHERE id = $1"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2).WillReturnRows(rows)
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).WillReturnRows(rows)
 	srv := &server{
 		DB: &database.DBStore{DB: db},
 	}
 	req := httptest.NewRequest("GET", "/tasks?id=2", nil)
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskList()(w, req)
 
@@ -77,7 +203,7 @@ func TestHandleTaskListOneTask(t *testing.T) {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 
-	expectedResp := `{"id":2,"content":"Task 2","state":false}`
+	expectedResp := taskJSON(2, "Task 2", false)
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusOK, w.Code)
 }
@@ -89,12 +215,13 @@ func TestHandleTaskListIDNotFound(t *testing.T) {
 	}
 	defer db.Close()
 
-	query := "SELECT id, content, state FROM tasks WHERE id = $1"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2).WillReturnError(sql.ErrNoRows)
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).WillReturnError(sql.ErrNoRows)
 	srv := &server{
 		DB: &database.DBStore{DB: db},
 	}
 	req := httptest.NewRequest("GET", "/tasks?id=2", nil)
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskList()(w, req)
 
@@ -103,8 +230,11 @@ func TestHandleTaskListIDNotFound(t *testing.T) {
 	}
 
 	expectedResp := `{
-		"error": "Task id=2 not found",
-		"detail": "sql: no rows in result set"
+		"type": "urn:todolist:problem:not_found",
+		"title": "Cannot load task",
+		"status": 404,
+		"code": "not_found",
+		"detail": "task 2 not found"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusNotFound, w.Code)
@@ -121,12 +251,15 @@ func TestHandleTaskListQueryNotFound(t *testing.T) {
 		DB: &database.DBStore{DB: db},
 	}
 	req := httptest.NewRequest("GET", "/tasks?id=", nil)
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskList()(w, req)
 
 	expectedResp := `{
-		"error": "Query parameter 'id' not found",
-		"detail": ""
+		"type": "urn:todolist:problem:not_found",
+		"title": "Query parameter 'id' not found",
+		"status": 404,
+		"code": "not_found"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusNotFound, w.Code)
@@ -146,10 +279,11 @@ func TestHandleTaskDelete(t *testing.T) {
 	}
 
 	taskID := "12"
-	delete := "DELETE FROM tasks WHERE id = \\$1"
-	mock.ExpectExec(delete).WithArgs(12).WillReturnResult(sqlmock.NewResult(1, 1))
+	delete := "DELETE FROM tasks WHERE id = \\$1 AND user_id = \\$2"
+	mock.ExpectExec(delete).WithArgs(12, testUserID, 0).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	req := httptest.NewRequest("DELETE", "/tasks/"+taskID, nil)
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": taskID})
 	w := httptest.NewRecorder()
 	srv.handleTaskDelete()(w, req)
@@ -175,10 +309,11 @@ func TestHandleTaskDeleteIDNotFound(t *testing.T) {
 	}
 
 	taskID := "12"
-	delete := "DELETE FROM tasks WHERE id = \\$1"
-	mock.ExpectExec(delete).WithArgs(12).WillReturnResult(sqlmock.NewResult(0, 0))
+	delete := "DELETE FROM tasks WHERE id = \\$1 AND user_id = \\$2"
+	mock.ExpectExec(delete).WithArgs(12, testUserID, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	req := httptest.NewRequest("DELETE", "/tasks/"+taskID, nil)
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": taskID})
 	w := httptest.NewRecorder()
 	srv.handleTaskDelete()(w, req)
@@ -188,11 +323,14 @@ func TestHandleTaskDeleteIDNotFound(t *testing.T) {
 	}
 
 	expectedResp := `{
-		"error": "Cannot delete task",
-		"detail": "task with ID 12 does not exist"
+		"type": "urn:todolist:problem:not_found",
+		"title": "Cannot delete task",
+		"status": 404,
+		"code": "not_found",
+		"detail": "task 12 not found"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 // Create task
@@ -210,33 +348,79 @@ func TestHandleTaskCreate(t *testing.T) {
 
 	task := &database.Task{
 		ID:      0,
+		UserID:  testUserID,
 		Content: "test task content",
 		State:   false,
 	}
 
-	insert := "INSERT INTO tasks (content,state) VALUES ($1, $2) RETURNING id"
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
 	mock.ExpectQuery(regexp.QuoteMeta(insert)).
-		WithArgs(task.Content, task.State).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		WithArgs(task.UserID, nil, task.Content, "", task.State, database.PriorityNone, nil, nil, false, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(1, testTime, testTime, 1))
 
 	requestBody := []byte(`{"content": "test task content"}`)
 	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskCreate()(w, req)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
-	expectedResp := `{
-		"id": 1,
-		"content": "test task content",
-		"state": false
-	  }`
+	expectedResp := taskJSON(1, "test task content", false)
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusOK, w.Code)
 
 }
 
+func TestHandleTaskCreateTrimsFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
+	mock.ExpectQuery(regexp.QuoteMeta(insert)).
+		WithArgs(testUserID, nil, "test task content", "first line\nsecond line", false, database.PriorityNone, nil, nil, false, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(1, testTime, testTime, 1))
+
+	requestBody := []byte(`{"content": "  test task content ", "description": "\nfirst line\nsecond line\n"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleTaskCreateUnknownField(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"content": "test task content", "done": true}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:bad_request",
+		"title": "Cannot decode task body from json",
+		"status": 400,
+		"code": "bad_request",
+		"detail": "json: unknown field \"done\""
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestHandleTaskCreateContentEmpty(t *testing.T) {
 	db, _, err := sqlmock.New()
 	if err != nil {
@@ -250,15 +434,19 @@ func TestHandleTaskCreateContentEmpty(t *testing.T) {
 
 	requestBody := []byte(`{"content": ""}`)
 	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskCreate()(w, req)
 
 	expectedResp := `{
-		"error": "Key 'content' cannot be empty",
-		"detail": ""
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "content", "message": "Key 'content' cannot be empty"}]
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
-	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 
 }
 
@@ -275,11 +463,15 @@ func TestHandleTaskCreateBadContentInt(t *testing.T) {
 
 	requestBody := []byte(`{"content": 43}`)
 	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	w := httptest.NewRecorder()
 	srv.handleTaskCreate()(w, req)
 
 	expectedResp := `{
-		"error": "Cannot decode task body from json",
+		"type": "urn:todolist:problem:bad_request",
+		"title": "Cannot decode task body from json",
+		"status": 400,
+		"code": "bad_request",
 		"detail": "json: cannot unmarshal number into Go struct field request.content of type string"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
@@ -287,8 +479,200 @@ func TestHandleTaskCreateBadContentInt(t *testing.T) {
 
 }
 
+func TestHandleTaskCreateDetails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	dueAt := time.Date(2024, 3, 8, 18, 0, 0, 0, time.UTC)
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
+	mock.ExpectQuery(regexp.QuoteMeta(insert)).
+		WithArgs(testUserID, nil, "Write report", "Quarterly numbers", false, database.PriorityHigh, dueAt, nil, false, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(3, testTime, testTime, 1))
+
+	requestBody := []byte(`{
+		"content": "Write report",
+		"description": "Quarterly numbers",
+		"priority": "high",
+		"due_at": "2024-03-08T18:00:00Z"
+	}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	expectedResp := `{
+		"id": 3,
+		"list_id": null,
+		"content": "Write report",
+		"description": "Quarterly numbers",
+		"state": false,
+		"priority": "high",
+		"tags": [],
+		"due_at": "2024-03-08T18:00:00Z",
+		"created_at": "2024-03-01T12:00:00Z",
+		"updated_at": "2024-03-01T12:00:00Z",
+		"completed_at": null,
+		"version": 1,
+		"parent_id": null,
+		"auto_complete": false,
+		"subtasks": {"total": 0, "done": 0},
+		"recurrence": null
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleTaskCreateBadPriority(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"content": "Write report", "priority": "urgent"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "priority", "message": "Key 'priority' must be none, low, medium or high"}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleTaskCreateRecurring(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	// Rules are stored in canonical form
+	insert := "INSERT INTO tasks (user_id,list_id,content,description,state,priority,due_at,parent_id,auto_complete,recurrence)"
+	mock.ExpectQuery(regexp.QuoteMeta(insert)).
+		WithArgs(testUserID, nil, "Team meeting", "", false, database.PriorityNone, nil, nil, false, "FREQ=WEEKLY;BYDAY=MO,TH").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).AddRow(1, testTime, testTime, 1))
+
+	requestBody := []byte(`{"content": "Team meeting", "recurrence": "RRULE:freq=weekly;interval=1;byday=MO,TH"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"recurrence":"FREQ=WEEKLY;BYDAY=MO,TH"`)
+}
+
+func TestHandleTaskCreateBadRecurrence(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"content": "Team meeting", "recurrence": "FREQ=HOURLY"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "recurrence", "message": "Key 'recurrence' is not a valid rule : FREQ must be DAILY, WEEKLY or MONTHLY"}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleTaskCreateRecurrenceNeverDue(t *testing.T) {
+	srv := &server{}
+
+	// Every February from the due date, which never has a 30th
+	requestBody := []byte(`{"content": "Report", "due_at": "2024-02-01T09:00:00Z", "recurrence": "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "recurrence", "message": "Key 'recurrence' never recurs from 'due_at' : rule has no occurrence after 2024-02-01"}]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleTaskCreateAllInvalidFields(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"content": "", "recurrence": "FREQ=HOURLY"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [
+			{"field": "content", "message": "Key 'content' cannot be empty"},
+			{"field": "recurrence", "message": "Key 'recurrence' is not a valid rule : FREQ must be DAILY, WEEKLY or MONTHLY"}
+		]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleTaskCreateInvalidFields(t *testing.T) {
+	srv := &server{}
+
+	requestBody := []byte(`{"content": "", "priority": "urgent"}`)
+	req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(requestBody))
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskCreate()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [
+			{"field": "content", "message": "Key 'content' cannot be empty"},
+			{"field": "priority", "message": "Key 'priority' must be none, low, medium or high"}
+		]
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
 // Edit task
 
+const editTask = "UPDATE tasks SET content = $1, description = $2, priority = $3, due_at = $4, updated_at = now(), version = version + 1"
+
 func TestHandleTaskEdit(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -303,22 +687,15 @@ func TestHandleTaskEdit(t *testing.T) {
 	taskID := "12"
 	content := "test task content"
 
-	query := "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(12).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-
-	mock.ExpectExec("UPDATE tasks SET content = \\$1 WHERE id = \\$2").
-		WithArgs(content, 12).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	rows := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(12, content, false)
-
-	query = "SELECT id, content, state FROM tasks WHERE id = $1"
-	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(12).WillReturnRows(rows)
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(12, content, false)...)
+	mock.ExpectQuery(regexp.QuoteMeta(editTask)).
+		WithArgs(content, "", database.PriorityNone, nil, 12, testUserID, 0).
+		WillReturnRows(rows)
 
 	requestBody := []byte(`{"content": "test task content"}`)
 	req := httptest.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": taskID})
 	w := httptest.NewRecorder()
 	srv.handleTaskEdit()(w, req)
@@ -326,11 +703,7 @@ func TestHandleTaskEdit(t *testing.T) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
-	expectedResp := `{
-		"id": 12,
-		"content": "test task content",
-		"state": false
-	  }`
+	expectedResp := taskJSON(12, "test task content", false)
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusOK, w.Code)
 }
@@ -350,13 +723,17 @@ func TestHandleTaskEditBodyWrongType(t *testing.T) {
 
 	requestBody := []byte(`{"content": 40}`)
 	req := httptest.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": taskID})
 	w := httptest.NewRecorder()
 	srv.handleTaskEdit()(w, req)
 
 	expectedResp := `{
-		"error": "Cannot parse task body",
-		"detail": "json: cannot unmarshal number into Go struct field request.content of type string"
+		"type": "urn:todolist:problem:bad_request",
+		"title": "Cannot parse task body",
+		"status": 400,
+		"code": "bad_request",
+		"detail": "json: cannot unmarshal number into Go struct field taskRequest.content of type string"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -377,16 +754,20 @@ func TestHandleTaskEditContentEmpty(t *testing.T) {
 
 	requestBody := []byte(`{"content": ""}`)
 	req := httptest.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(requestBody))
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": taskID})
 	w := httptest.NewRecorder()
 	srv.handleTaskEdit()(w, req)
 
 	expectedResp := `{
-		"error": "Key 'content' cannot be empty",
-		"detail": ""
+		"type": "urn:todolist:problem:validation_failed",
+		"title": "Task is not valid",
+		"status": 422,
+		"code": "validation_failed",
+		"errors": [{"field": "content", "message": "Key 'content' cannot be empty"}]
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
-	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 }
 
 // Change task state
@@ -402,22 +783,47 @@ func TestHandleChangeTaskState(t *testing.T) {
 	}
 
 	taskID := 12
-	state := true
+	query := "UPDATE tasks SET state = NOT state"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(taskID, "Task 1", true, true)...)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(taskID, testUserID, 0).WillReturnRows(rows)
+	mock.ExpectCommit()
 
-	query := "SELECT id, content, state FROM tasks WHERE id = \\$1"
-	rows1 := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(taskID, "Task 1", !state)
-	mock.ExpectQuery(query).WithArgs(taskID).WillReturnRows(rows1)
+	req := httptest.NewRequest("PUT", "/tasks/state/12", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskState()(w, req)
 
-	mock.ExpectExec("UPDATE tasks SET state = \\$1 WHERE id = \\$2").
-		WithArgs(state, taskID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	expectedResp := taskJSON(12, "Task 1", true)
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+}
 
-	rows2 := sqlmock.NewRows([]string{"id", "content", "state"}).
-		AddRow(taskID, "Task 1", state)
-	mock.ExpectQuery(query).WithArgs(taskID).WillReturnRows(rows2)
+func TestHandleChangeTaskStateBadID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	taskID := 12
+	query := "UPDATE tasks SET state = NOT state"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(taskID, testUserID, 0).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	mock.ExpectQuery(openBlockers).WithArgs(taskID, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 	req := httptest.NewRequest("PUT", "/tasks/state/12", nil)
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": "12"})
 	w := httptest.NewRecorder()
 	srv.handleTaskState()(w, req)
@@ -426,41 +832,439 @@ func TestHandleChangeTaskState(t *testing.T) {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 	expectedResp := `{
-		"id": 12,
-		"content": "Task 1",
-		"state": true
+		"type": "urn:todolist:problem:not_found",
+		"title": "Cannot change task state",
+		"status": 404,
+		"code": "not_found",
+		"detail": "task 12 not found"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+const openBlockers = "SELECT blockers.id FROM task_dependencies"
+
+const setTaskState = "UPDATE tasks SET state = $1, completed_at = CASE WHEN $1 THEN COALESCE(completed_at, now()) END"
+
+func TestHandleTaskSetState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(12, "Task 1", false, false)...)
+	mock.ExpectQuery(regexp.QuoteMeta(setTaskState)).WithArgs(false, 12, testUserID, 0).WillReturnRows(rows)
+
+	req := httptest.NewRequest("PUT", "/tasks/12/state", bytes.NewBufferString(`{"state": false}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskSetState()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.JSONEq(t, taskJSON(12, "Task 1", false), w.Body.String())
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
-func TestHandleChangeTaskStateBadID(t *testing.T) {
+func TestHandleTaskSetStateMissing(t *testing.T) {
+	srv := &server{}
+	req := httptest.NewRequest("PUT", "/tasks/12/state", bytes.NewBufferString(`{}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskSetState()(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandleTaskComplete(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
-		t.Errorf("Error while creating mock : %s", err)
+		t.Fatalf("Error while creating mock : %s", err)
 	}
 	defer db.Close()
 	srv := &server{
 		DB: &database.DBStore{DB: db},
 	}
 
-	taskID := 12
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(setTaskState)).WithArgs(true, 12, testUserID, 0).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	mock.ExpectQuery(openBlockers).WithArgs(12, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
-	query := "SELECT id, content, state FROM tasks WHERE id = \\$1"
-	mock.ExpectQuery(query).WithArgs(taskID).WillReturnError(sql.ErrNoRows)
+	req := httptest.NewRequest("POST", "/tasks/12/complete", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskSetStateTo(true)(w, req)
 
-	req := httptest.NewRequest("PUT", "/tasks/state/12", nil)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleTaskCompletePreconditionFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(setTaskState)).WithArgs(true, 12, testUserID, 5).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	query := "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(12, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	req := httptest.NewRequest("POST", "/tasks/12/complete", nil)
+	req.Header.Set("If-Match", `"5"`)
+	req = withUser(req)
 	req = mux.SetURLVars(req, map[string]string{"id": "12"})
 	w := httptest.NewRecorder()
-	srv.handleTaskState()(w, req)
+	srv.handleTaskSetStateTo(true)(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestHandleTaskListOneTaskDeprecated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(2, "Task 2", false)...)
+
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).WillReturnRows(rows)
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+	req := httptest.NewRequest("GET", "/tasks?id=2", nil)
+	req = withUser(req)
+	w := httptest.NewRecorder()
+	srv.handleTaskList()(w, req)
+
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/tasks/2>; rel="successor-version"`, w.Header().Get("Link"))
+}
+
+// Single task
+
+func TestHandleTaskGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	rows := sqlmock.NewRows(taskColumns).
+		AddRow(taskValues(2, "Task 2", false)...)
+
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).WillReturnRows(rows)
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+	req := httptest.NewRequest("GET", "/tasks/2", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	w := httptest.NewRecorder()
+	srv.handleTaskGet()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.JSONEq(t, taskJSON(2, "Task 2", false), w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestHandleTaskGetNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).WillReturnError(sql.ErrNoRows)
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+	req := httptest.NewRequest("GET", "/tasks/2", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	w := httptest.NewRecorder()
+	srv.handleTaskGet()(w, req)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("Expectations were not met : %s", err)
 	}
 	expectedResp := `{
-		"error": "Task not found",
-		"detail": "sql: no rows in result set"
+		"type": "urn:todolist:problem:not_found",
+		"title": "Cannot load task",
+		"status": 404,
+		"code": "not_found",
+		"detail": "task 2 not found"
 	  }`
 	assert.JSONEq(t, expectedResp, w.Body.String())
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+func TestHandleTaskPatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	query := "UPDATE tasks SET updated_at = now(), version = version + 1, state = $1, " +
+		"completed_at = CASE WHEN $1 THEN COALESCE(completed_at, now()) END WHERE id = $2 AND user_id = $3 AND ($4 = 0 OR version = $4) " +
+		"AND (state OR " + notBlocked + ") RETURNING " + selectedTaskColumns + ", " +
+		"state AND completed_at = now()"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(12, "Task 1", true, true)...)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(true, 12, testUserID, 0).WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{"state": true}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.JSONEq(t, taskJSON(12, "Task 1", true), w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleTaskPatchClearDueDate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	query := "UPDATE tasks SET updated_at = now(), version = version + 1, priority = $1, due_at = $2 WHERE id = $3 AND user_id = $4"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(12, "Task 1", false, false)...)
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(database.PriorityNone, nil, 12, testUserID, 0).
+		WillReturnRows(rows)
+
+	body := `{"priority": "none", "due_at": null}`
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(body))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleTaskPatchStopRecurrence(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	query := "UPDATE tasks SET updated_at = now(), version = version + 1, recurrence = $1 WHERE id = $2 AND user_id = $3"
+	rows := sqlmock.NewRows(taskChangeColumns).
+		AddRow(taskChangeValues(12, "Task 1", false, false)...)
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs("", 12, testUserID, 0).WillReturnRows(rows)
+
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{"recurrence": null}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"recurrence":null`)
+}
+
+func TestHandleTaskPatchContentOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	// Renaming a task from the client must keep its other fields
+	values := taskChangeValues(12, "new content", false, false)
+	values[4] = "notes"
+	values[6] = database.PriorityHigh
+	values[7] = testTime
+	values[11] = 6
+	query := "UPDATE tasks SET updated_at = now(), version = version + 1, content = $1 WHERE id = $2 AND user_id = $3"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs("new content", 12, testUserID, 5).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(values...))
+
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{"content": "new content"}`))
+	req.Header.Set("If-Match", `"5"`)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"description":"notes"`)
+	assert.Contains(t, w.Body.String(), `"priority":"high"`)
+	assert.Contains(t, w.Body.String(), `"due_at":"2024-03-01T12:00:00Z"`)
+}
+
+func TestHandleTaskPatchEmpty(t *testing.T) {
+	srv := &server{}
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{}`))
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	expectedResp := `{
+		"type": "urn:todolist:problem:bad_request",
+		"title": "Request body has no field to update",
+		"status": 400,
+		"code": "bad_request"
+	  }`
+	assert.JSONEq(t, expectedResp, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Concurrency control
+
+func TestHandleTaskGetETag(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	values := taskValues(2, "Task 2", false)
+	values[11] = 5
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+	req := httptest.NewRequest("GET", "/tasks/2", nil)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	w := httptest.NewRecorder()
+	srv.handleTaskGet()(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+}
+
+func TestHandleTaskEditIfMatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	values := taskValues(12, "new content", false)
+	values[11] = 6
+	mock.ExpectQuery(regexp.QuoteMeta(editTask)).
+		WithArgs("new content", "", database.PriorityNone, nil, 12, testUserID, 5).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(values...))
+
+	req := httptest.NewRequest("PUT", "/tasks/12", bytes.NewBufferString(`{"content": "new content"}`))
+	req.Header.Set("If-Match", `"5"`)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskEdit()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"6"`, w.Header().Get("ETag"))
+}
+
+func TestHandleTaskPatchPreconditionFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := &server{
+		DB: &database.DBStore{DB: db},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET updated_at = now(), version = version + 1, content = $1")).
+		WithArgs("new content", 12, testUserID, 5).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+	query := "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(12, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	req := httptest.NewRequest("PATCH", "/tasks/12", bytes.NewBufferString(`{"content": "new content"}`))
+	req.Header.Set("If-Match", `"5"`)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskPatch()(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestHandleTaskDeleteWeakIfMatch(t *testing.T) {
+	srv := &server{}
+	req := httptest.NewRequest("DELETE", "/tasks/12", nil)
+	req.Header.Set("If-Match", `W/"5"`)
+	req = withUser(req)
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	w := httptest.NewRecorder()
+	srv.handleTaskDelete()(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
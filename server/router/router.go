@@ -1,10 +1,104 @@
 package router
 
+import (
+	"net/http"
+
+	"github.com/Thybaau/todolist-app/middleware"
+	"github.com/gorilla/mux"
+)
+
+// APIPrefix is the path of the current version of the API
+const APIPrefix = "/api/v1"
+
 func (s *server) router() {
 	s.Router.HandleFunc("/", s.handleIndex()).Methods("GET")
-	s.Router.HandleFunc("/tasks", s.handleTaskList()).Methods("GET")
-	s.Router.HandleFunc("/tasks", s.handleTaskCreate()).Methods("POST")
-	s.Router.HandleFunc("/tasks/{id:[0-9]+}", s.handleTaskDelete()).Methods("DELETE")
-	s.Router.HandleFunc("/tasks/{id:[0-9]+}", s.handleTaskEdit()).Methods("PUT")
-	s.Router.HandleFunc("/tasks/state/{id:[0-9]+}", s.handleTaskState()).Methods("PUT")
+	s.Router.HandleFunc("/healthz", s.handleHealthz()).Methods("GET", "HEAD")
+	s.Router.HandleFunc("/readyz", s.handleReadyz()).Methods("GET", "HEAD")
+
+	api := s.Router.PathPrefix(APIPrefix).Subrouter()
+	api.Use(middleware.JSONOnly)
+	s.routes(api)
+
+	// Unversioned routes of the previous release, kept for one more release
+	legacy := s.Router.NewRoute().Subrouter()
+	legacy.Use(deprecatedUnversioned, middleware.JSONOnly)
+	s.legacyRoutes(legacy)
+}
+
+// legacyRoutes registers on r the routes that existed before APIPrefix, new
+// resources are only served under APIPrefix
+func (s *server) legacyRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/register", s.handleRegister()).Methods("POST")
+	r.HandleFunc("/auth/login", s.handleLogin()).Methods("POST")
+	r.HandleFunc("/auth/refresh", s.handleRefresh()).Methods("POST")
+	r.Handle("/auth/logout", s.requireAuth(s.handleLogout())).Methods("POST")
+
+	tasks := r.PathPrefix("/tasks").Subrouter()
+	tasks.Use(s.requireAuth)
+	tasks.HandleFunc("", s.handleTaskList()).Methods("GET")
+	tasks.HandleFunc("", s.handleTaskCreate()).Methods("POST")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskGet()).Methods("GET")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskEdit()).Methods("PUT")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskPatch()).Methods("PATCH")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskDelete()).Methods("DELETE")
+	tasks.HandleFunc("/state/{id:[0-9]+}", s.handleTaskState()).Methods("PUT")
+}
+
+// routes registers the routes of the API on r
+func (s *server) routes(r *mux.Router) {
+	r.HandleFunc("/auth/register", s.handleRegister()).Methods("POST")
+	r.HandleFunc("/auth/login", s.handleLogin()).Methods("POST")
+	r.HandleFunc("/auth/refresh", s.handleRefresh()).Methods("POST")
+	r.Handle("/auth/logout", s.requireAuth(s.handleLogout())).Methods("POST")
+
+	keys := r.PathPrefix("/auth/keys").Subrouter()
+	keys.Use(s.requireAuth, sessionOnly)
+	keys.HandleFunc("", s.handleAPIKeyList()).Methods("GET")
+	keys.HandleFunc("", s.handleAPIKeyCreate()).Methods("POST")
+	keys.HandleFunc("/{id:[0-9]+}", s.handleAPIKeyRevoke()).Methods("DELETE")
+
+	// Tasks are only reachable by their owner
+	tasks := r.PathPrefix("/tasks").Subrouter()
+	tasks.Use(s.requireAuth)
+	tasks.HandleFunc("", s.handleTaskList()).Methods("GET")
+	tasks.HandleFunc("", s.handleTaskCreate()).Methods("POST")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskGet()).Methods("GET")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskEdit()).Methods("PUT")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskPatch()).Methods("PATCH")
+	tasks.HandleFunc("/{id:[0-9]+}", s.handleTaskDelete()).Methods("DELETE")
+	tasks.HandleFunc("/{id:[0-9]+}/state", s.handleTaskSetState()).Methods("PUT")
+	tasks.HandleFunc("/{id:[0-9]+}/complete", s.handleTaskSetStateTo(true)).Methods("POST")
+	tasks.HandleFunc("/{id:[0-9]+}/reopen", s.handleTaskSetStateTo(false)).Methods("POST")
+	tasks.HandleFunc("/{id:[0-9]+}/tags/{tag}", s.handleTaskTag(true)).Methods("PUT")
+	tasks.HandleFunc("/{id:[0-9]+}/tags/{tag}", s.handleTaskTag(false)).Methods("DELETE")
+	tasks.HandleFunc("/{id:[0-9]+}/subtasks", s.handleTaskTree()).Methods("GET")
+	tasks.HandleFunc("/{id:[0-9]+}/subtasks", s.handleSubtaskCreate()).Methods("POST")
+	tasks.HandleFunc("/{id:[0-9]+}/blockers/{blocker_id:[0-9]+}", s.handleTaskBlocker(true)).Methods("PUT")
+	tasks.HandleFunc("/{id:[0-9]+}/blockers/{blocker_id:[0-9]+}", s.handleTaskBlocker(false)).Methods("DELETE")
+	tasks.HandleFunc("/{id:[0-9]+}/dependencies", s.handleTaskDependencies()).Methods("GET")
+	r.Handle("/tags", s.requireAuth(s.handleTags())).Methods("GET")
+
+	// Lists and their tasks, only reachable by their owner
+	lists := r.PathPrefix("/lists").Subrouter()
+	lists.Use(s.requireAuth)
+	lists.HandleFunc("", s.handleLists()).Methods("GET")
+	lists.HandleFunc("", s.handleListCreate()).Methods("POST")
+	lists.HandleFunc("/{id:[0-9]+}", s.handleListGet()).Methods("GET")
+	lists.HandleFunc("/{id:[0-9]+}", s.handleListEdit()).Methods("PUT")
+	lists.HandleFunc("/{id:[0-9]+}", s.handleListDelete()).Methods("DELETE")
+	lists.HandleFunc("/{id:[0-9]+}/tasks", s.handleListTasks()).Methods("GET")
+	lists.HandleFunc("/{id:[0-9]+}/tasks", s.handleListTaskCreate()).Methods("POST")
+}
+
+// deprecatedUnversioned points the responses of unversioned routes to the
+// same route under APIPrefix
+func deprecatedUnversioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.Deprecated(w, APIPrefix+r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) requireAuth(next http.Handler) http.Handler {
+	return middleware.RequireAuth(s.authenticate)(next)
 }
@@ -0,0 +1,159 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Thybaau/todolist-app/auth"
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPINotAcceptable(t *testing.T) {
+	srv := NewServer()
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("Accept", "text/html, application/json;q=0")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestAPIUnsupportedMediaType(t *testing.T) {
+	srv := NewServer()
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/login", bytes.NewBufferString("username=alice"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Accept"))
+}
+
+func TestUnversionedRouteDeprecated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(2, "Task 2", false)...))
+
+	req := httptest.NewRequest("GET", "/tasks/2", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/tasks/2>; rel="successor-version"`, w.Header().Get("Link"))
+}
+
+func TestUnversionedNewRoutesNotFound(t *testing.T) {
+	srv := NewServer()
+	for _, path := range []string{"/lists", "/tags", "/auth/keys", "/tasks/2/subtasks", "/tasks/2/dependencies"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+
+		// The versioned route exists, and needs a user
+		req = httptest.NewRequest("GET", APIPrefix+path, nil)
+		w = httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, APIPrefix+path)
+	}
+}
+
+func TestUnversionedTaskListLinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM tasks WHERE user_id = $1")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY id ASC LIMIT 2")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).
+			AddRow(taskValues(1, "Task 1", false)...).
+			AddRow(taskValues(2, "Task 2", false)...))
+
+	req := httptest.NewRequest("GET", "/tasks?limit=1", nil)
+	req.Header.Set("Authorization", "Bearer access")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Both links are kept, the successor of the route and the next page
+	links := w.Header().Values("Link")
+	assert.Len(t, links, 2)
+	assert.Contains(t, links, `</api/v1/tasks>; rel="successor-version"`)
+	assert.Contains(t, links, `</tasks?cursor=`+w.Header().Get("X-Next-Cursor")+`&limit=1>; rel="next"`)
+}
+
+func TestDeprecatedRoutesSuccessor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error while creating mock : %s", err)
+	}
+	defer db.Close()
+	srv := NewServer()
+	srv.DB = &database.DBStore{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE tasks SET state = NOT state")).WithArgs(2, testUserID, 0).
+		WillReturnRows(sqlmock.NewRows(taskChangeColumns).AddRow(taskChangeValues(2, "Task 2", true, true)...))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(selectSession)).WithArgs(auth.HashToken("access")).
+		WillReturnRows(sessionRows())
+	query := "SELECT " + selectedTaskColumns + " FROM tasks WHERE id = $1 AND user_id = $2"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(2, testUserID).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(taskValues(2, "Task 2", false)...))
+
+	// Each deprecated route points to the route replacing it, and only to it
+	tests := []struct {
+		method, path, successor string
+	}{
+		{"PUT", "/tasks/state/2", `</api/v1/tasks/2/state>; rel="successor-version"`},
+		{"GET", "/tasks?id=2", `</api/v1/tasks/2>; rel="successor-version"`},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("Authorization", "Bearer access")
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, test.path)
+		assert.Equal(t, "true", w.Header().Get("Deprecation"), test.path)
+		assert.Equal(t, []string{test.successor}, w.Header().Values("Link"), test.path)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expectations were not met : %s", err)
+	}
+}
@@ -1,18 +1,30 @@
 package router
 
 import (
+	"time"
+
+	"github.com/Thybaau/todolist-app/auth"
 	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/metrics"
 	"github.com/gorilla/mux"
 )
 
 type server struct {
 	Router *mux.Router
 	DB     database.Database
+	// Business counters, none if nil
+	Metrics *metrics.Metrics
+
+	// Lifetime of the tokens issued at login
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 }
 
 func NewServer() *server {
 	s := &server{
-		Router: mux.NewRouter(),
+		Router:          mux.NewRouter(),
+		AccessTokenTTL:  auth.DefaultAccessTokenTTL,
+		RefreshTokenTTL: auth.DefaultRefreshTokenTTL,
 	}
 	s.router()
 	return s
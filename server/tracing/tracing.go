@@ -0,0 +1,128 @@
+// Package tracing sets up OpenTelemetry tracing : a span per HTTP request,
+// child spans per database call, and W3C trace context propagation.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/logging"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the server in traces
+const ServiceName = "todolist-server"
+
+// Name of the tracer of the spans created by this package
+const tracerName = "github.com/Thybaau/todolist-app/tracing"
+
+// Exporters of Setup
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. Spans are sent by exporter : over OTLP/HTTP to endpoint (or
+// the OTEL_EXPORTER_OTLP_* variables if it is empty), written to stdout, or
+// not recorded with ExporterNone. sampleRatio is the fraction of traces that
+// are sampled, new ones or started by a caller which did not sample them,
+// traces sampled by the caller are always sampled.
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, exporter, endpoint string, sampleRatio float64, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(exporter) {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio),
+			sdktrace.WithRemoteParentNotSampled(sdktrace.TraceIDRatioBased(sampleRatio)))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware is a mux middleware starting a span per request, named after
+// the method and path template of its route, and continuing the trace of
+// the traceparent header. The logger of the request context logs the trace
+// ID with every record.
+func Middleware(next http.Handler) http.Handler {
+	return otelmux.Middleware(ServiceName,
+		otelmux.WithSpanNameFormatter(func(route string, r *http.Request) string {
+			return r.Method + " " + route
+		}),
+	)(withTraceLogger(next))
+}
+
+func withTraceLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger := logging.FromContext(r.Context()).With("trace_id", sc.TraceID().String())
+			r = r.WithContext(logging.NewContext(r.Context(), logger))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// QueryHook starts a child span for every call of a database.DBStore, named
+// after its method. Domain errors (such as a missing task) are recorded as
+// events, other errors also fail the span.
+func QueryHook(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "DBStore."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(method)),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			var domainErr *database.Error
+			if !errors.As(err, &domainErr) {
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		span.End()
+	}
+}
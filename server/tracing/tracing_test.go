@@ -0,0 +1,95 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Thybaau/todolist-app/database"
+	"github.com/Thybaau/todolist-app/tracing"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestMiddlewareSpanPerRequest(t *testing.T) {
+	recorder := recordSpans(t)
+	r := mux.NewRouter()
+	r.Use(tracing.Middleware)
+	r.HandleFunc("/api/v1/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, end := tracing.QueryHook(r.Context(), "GetTask")
+		end(nil)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	query, request := spans[0], spans[1]
+
+	assert.Equal(t, "GET /api/v1/tasks/{id}", request.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+	attrs := attributes(request)
+	assert.Equal(t, "/api/v1/tasks/{id}", attrs["http.route"].AsString())
+	assert.Equal(t, int64(http.StatusNotFound), attrs["http.status_code"].AsInt64())
+
+	assert.Equal(t, "DBStore.GetTask", query.Name())
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	assert.Equal(t, request.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, "GetTask", attributes(query)["db.operation"].AsString())
+	assert.Equal(t, "postgresql", attributes(query)["db.system"].AsString())
+}
+
+func TestQueryHookErrors(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, end := tracing.QueryHook(context.Background(), "GetTask")
+	end(database.ErrVersionMismatch)
+	_, end = tracing.QueryHook(context.Background(), "CreateTask")
+	end(errors.New("connexion refused"))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "connexion refused", spans[1].Status().Description)
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), "jaeger", "", 1, nil)
+	assert.EqualError(t, err, `unknown trace exporter "jaeger"`)
+}